@@ -2,4 +2,9 @@ module github.com/Lensual/KobackupCipherTool-go
 
 go 1.24.0
 
-require golang.org/x/crypto v0.48.0
+require (
+	golang.org/x/crypto v0.48.0
+	golang.org/x/term v0.40.0
+)
+
+require golang.org/x/sys v0.41.0 // indirect
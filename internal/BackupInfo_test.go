@@ -0,0 +1,40 @@
+package internal_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+)
+
+// FuzzReadUTF16LEFile 检查任意文件内容（包括奇数长度和只有 BOM 的文件）都不会 panic，UTF-16LE 文件解码为合法的 UTF-8
+func FuzzReadUTF16LEFile(f *testing.F) {
+	f.Add([]byte{0xFF, 0xFE, '[', 0, 'a', 0, ']', 0})
+	f.Add([]byte{0xFF, 0xFE, '['})
+	f.Add([]byte{0xFF, 0xFE})
+	f.Add([]byte{0xFF})
+	f.Add([]byte{0xFE, 0xFF, 0, '['})
+	f.Add([]byte{0xFF, 0xFE, 0, 0, '[', 0, 0})
+	f.Add([]byte{0xFF, 0xFE, 0x3D, 0xD8})
+	f.Add([]byte("[headerinfo]\r\nhisuiteversion=14.0.0.320\r\n"))
+	f.Add([]byte{})
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, content []byte) {
+		path := filepath.Join(dir, "backupinfo.ini")
+		err := os.WriteFile(path, content, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := internal.ReadUTF16LEFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(content, []byte{0xFF, 0xFE}) && !utf8.ValidString(s) {
+			t.Fatalf("result %q is not valid UTF-8", s)
+		}
+	})
+}
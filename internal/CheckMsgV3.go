@@ -1,9 +1,24 @@
 package internal
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// MaxCheckMsgV3Length limits the checkMsgV3 string, a backup with ten thousand chunks needs about 2 MB
+	MaxCheckMsgV3Length = 16 << 20
+	// MaxFileNameLength limits the file name of an item, same as common file systems
+	MaxFileNameLength = 255
 )
 
 type CheckMsgV3Item struct {
@@ -12,40 +27,174 @@ type CheckMsgV3Item struct {
 	FileName     string
 }
 
-// ParseCheckMsgV3 parse the CheckMsgV3
+// CheckMsgV3Mode how ParseCheckMsgV3Mode handles invalid items
+type CheckMsgV3Mode int
+
+const (
+	// CheckMsgV3Strict return no items when any item is invalid
+	CheckMsgV3Strict CheckMsgV3Mode = iota
+	// CheckMsgV3Tolerant return the valid items together with the errors of the invalid ones
+	CheckMsgV3Tolerant
+)
+
+// CheckMsgV3ItemError an invalid item of checkMsgV3
+type CheckMsgV3ItemError struct {
+	Index int    // index of the item, starting from 0
+	Item  string // the item as in info.xml
+	Err   error
+}
+
+func (e *CheckMsgV3ItemError) Error() string {
+	return fmt.Sprintf("checkMsgV3 item %d: %v", e.Index, e.Err)
+}
+
+func (e *CheckMsgV3ItemError) Unwrap() error {
+	return e.Err
+}
+
+// CheckMsgV3Error all invalid items of checkMsgV3
+type CheckMsgV3Error struct {
+	Items []*CheckMsgV3ItemError
+}
+
+func (e *CheckMsgV3Error) Error() string {
+	if len(e.Items) == 1 {
+		return e.Items[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more invalid items)", e.Items[0], len(e.Items)-1)
+}
+
+func (e *CheckMsgV3Error) Unwrap() []error {
+	errs := make([]error, 0, len(e.Items))
+	for _, item := range e.Items {
+		errs = append(errs, item)
+	}
+	return errs
+}
+
+// ParseCheckMsgV3 parse the CheckMsgV3 in strict mode
 //
 //	checkMsgV3 string from info.xml
 //	r1 []CheckMsgV3Item CheckMsgV3 Items
 //	r2 error
 func ParseCheckMsgV3(checkMsgV3 string) ([]CheckMsgV3Item, error) {
+	return ParseCheckMsgV3Mode(checkMsgV3, CheckMsgV3Strict)
+}
+
+// ParseCheckMsgV3Mode parse the CheckMsgV3, items are separated by ** and each item is
+// 128 hex characters of hmac and salt, an underscore, then the file name in UTF-8
+//
+// the file name is everything after the underscore, so it may contain underscores itself
+//
+//	checkMsgV3 string from info.xml
+//	mode CheckMsgV3Mode how to handle invalid items
+//	r1 []CheckMsgV3Item valid items, nil in strict mode when any item is invalid
+//	r2 error *CheckMsgV3Error when some items are invalid, other errors when the whole string is invalid
+func ParseCheckMsgV3Mode(checkMsgV3 string, mode CheckMsgV3Mode) ([]CheckMsgV3Item, error) {
 	if len(checkMsgV3) < 128 {
 		return nil, errors.New("checkMsgV3 is less than 128 characters")
 	}
+	if len(checkMsgV3) > MaxCheckMsgV3Length {
+		return nil, fmt.Errorf("checkMsgV3 is longer than %d characters", MaxCheckMsgV3Length)
+	}
 
 	pendingItems := strings.Split(checkMsgV3, "**")
 	items := make([]CheckMsgV3Item, 0, len(pendingItems))
-	for _, pendingItem := range pendingItems {
+	var itemErrs []*CheckMsgV3ItemError
+	for i, pendingItem := range pendingItems {
 		// pendingItem e.g. e56ac33a0eb3e97e501ded79eecc16496feb009a3ec46911186881f3dd73f3b7cec932efa6414914304a7e024f96686c38c7137bd734a407ba0a40d24696f813_com.tencent.mm514.tar
-		strs := strings.Split(pendingItem, "_")
-		if len(strs) != 2 {
-			return nil, errors.New("assert split string length failed")
-		}
-		checkMsgV3PrefixStr := strs[0]
-		filename := strs[1]
-
-		expectedHmac, salt, err := parseCheckMsgV3ItemPrefixStr(checkMsgV3PrefixStr)
+		item, err := parseCheckMsgV3Item(pendingItem)
 		if err != nil {
-			return nil, err
+			itemErrs = append(itemErrs, &CheckMsgV3ItemError{Index: i, Item: pendingItem, Err: err})
+			continue
 		}
+		items = append(items, item)
+	}
+
+	if itemErrs == nil {
+		return items, nil
+	}
+	if mode == CheckMsgV3Strict {
+		return nil, &CheckMsgV3Error{Items: itemErrs}
+	}
+	return items, &CheckMsgV3Error{Items: itemErrs}
+}
+
+// parseCheckMsgV3Item parse a single item, hmac64+salt64_filename
+func parseCheckMsgV3Item(pendingItem string) (CheckMsgV3Item, error) {
+	if len(pendingItem) < 129 || pendingItem[128] != '_' {
+		return CheckMsgV3Item{}, errors.New("expected 128 hex characters followed by an underscore")
+	}
+	filename := pendingItem[129:]
+	if !utf8.ValidString(filename) {
+		return CheckMsgV3Item{}, fmt.Errorf("checkMsgV3 file name %q is not valid UTF-8", filename)
+	}
+	err := checkFileName(filename)
+	if err != nil {
+		return CheckMsgV3Item{}, err
+	}
+
+	expectedHmac, salt, err := parseCheckMsgV3ItemPrefixStr(pendingItem[:128])
+	if err != nil {
+		return CheckMsgV3Item{}, err
+	}
+
+	return CheckMsgV3Item{
+		ExpectedHmac: expectedHmac,
+		Salt:         salt,
+		FileName:     filename,
+	}, nil
+}
+
+// NewCheckMsgV3Item create an item with a random salt, ExpectedHmac is set after encrypting the file
+//
+// the file name must be one ParseCheckMsgV3 accepts back, it cannot contain the ** separator
+func NewCheckMsgV3Item(fileName string) (CheckMsgV3Item, error) {
+	if !utf8.ValidString(fileName) || strings.Contains(fileName, "**") {
+		return CheckMsgV3Item{}, fmt.Errorf("file name %q cannot be stored in checkMsgV3", fileName)
+	}
+	err := checkFileName(fileName)
+	if err != nil {
+		return CheckMsgV3Item{}, err
+	}
+
+	item := CheckMsgV3Item{
+		Salt:     make([]byte, SaltLength),
+		FileName: fileName,
+	}
+	_, err = rand.Read(item.Salt)
+	if err != nil {
+		return item, err
+	}
+	return item, nil
+}
 
-		items = append(items, CheckMsgV3Item{
-			ExpectedHmac: expectedHmac,
-			Salt:         salt,
-			FileName:     filename,
-		})
+// String format the item as hmac64+salt64_filename
+func (item CheckMsgV3Item) String() string {
+	return hex.EncodeToString(item.ExpectedHmac) + hex.EncodeToString(item.Salt) + "_" + item.FileName
+}
+
+// FormatCheckMsgV3 join the items as stored in info.xml
+func FormatCheckMsgV3(items []CheckMsgV3Item) string {
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		strs = append(strs, item.String())
 	}
+	return strings.Join(strs, "**")
+}
 
-	return items, nil
+// checkFileName make sure the file name can be joined with the backup directory,
+// info.xml is untrusted and a name like ../info.xml must not escape the directory
+func checkFileName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("checkMsgV3 file name is empty")
+	case len(name) > MaxFileNameLength:
+		return fmt.Errorf("checkMsgV3 file name is longer than %d bytes", MaxFileNameLength)
+	case name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00"):
+		return fmt.Errorf("checkMsgV3 file name %q is not a plain file name", name)
+	}
+	return nil
 }
 
 // parseCheckMsgV3ItemPrefixStr
@@ -70,3 +219,32 @@ func parseCheckMsgV3ItemPrefixStr(checkMsgV3PrefixStr string) ([]byte, []byte, e
 
 	return expectedHmac, salt, nil
 }
+
+// HmacKey derive the hmac key from password and the item salt
+//
+// the hmac key is the lowercase hex encoding of the pbkdf2 key
+//
+//	password string the password
+//	r1 []byte hmac key
+func (item CheckMsgV3Item) HmacKey(password string) []byte {
+	pbkdf2Key := pbkdf2.Key([]byte(password), item.Salt, Pbkdf2Iterations, 32, sha256.New)
+	return []byte(hex.EncodeToString(pbkdf2Key))
+}
+
+// NewHmac create the hmac-sha256 used to verify the file
+//
+//	password string the password
+//	r1 hash.Hash hmac-sha256
+func (item CheckMsgV3Item) NewHmac(password string) hash.Hash {
+	return NewHmacWithKey(item.HmacKey(password))
+}
+
+// NewHmacWithKey create the hmac-sha256 from a key returned by HmacKey
+func NewHmacWithKey(hmacKey []byte) hash.Hash {
+	return hmac.New(sha256.New, hmacKey)
+}
+
+// Verify compare the hmac result with ExpectedHmac
+func (item CheckMsgV3Item) Verify(fileHmac []byte) bool {
+	return hmac.Equal(fileHmac, item.ExpectedHmac)
+}
@@ -0,0 +1,119 @@
+package internal_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+)
+
+const sampleCheckMsgV3Item = "e56ac33a0eb3e97e501ded79eecc16496feb009a3ec46911186881f3dd73f3b7cec932efa6414914304a7e024f96686c38c7137bd734a407ba0a40d24696f813_com.tencent.mm514.tar"
+
+// TestParseCheckMsgV3 检查文件名可以包含下划线和 Unicode，无效的项在宽松模式下逐个报告
+func TestParseCheckMsgV3(t *testing.T) {
+	prefix := sampleCheckMsgV3Item[:128]
+	names := []string{"com.tencent.mm_plugin0.tar", "a_b_c.tar", "微信 备份_1.tar"}
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, prefix+"_"+name)
+	}
+
+	items, err := internal.ParseCheckMsgV3(strings.Join(parts, "**"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range items {
+		if item.FileName != names[i] {
+			t.Errorf("item %d: FileName = %q, want %q", i, item.FileName, names[i])
+		}
+	}
+
+	invalid := strings.Join([]string{parts[0], "zz" + prefix[2:] + "_bad.tar", prefix + "_../escape.tar", parts[1], prefix + "x.tar"}, "**")
+	items, err = internal.ParseCheckMsgV3(invalid)
+	var itemsErr *internal.CheckMsgV3Error
+	if items != nil || !errors.As(err, &itemsErr) {
+		t.Fatalf("strict: ParseCheckMsgV3 = %v, %v", items, err)
+	}
+
+	items, err = internal.ParseCheckMsgV3Mode(invalid, internal.CheckMsgV3Tolerant)
+	if !errors.As(err, &itemsErr) {
+		t.Fatalf("tolerant: err = %v, want *CheckMsgV3Error", err)
+	}
+	if len(items) != 2 || items[0].FileName != names[0] || items[1].FileName != names[1] {
+		t.Errorf("tolerant: items = %v", items)
+	}
+	var indexes []int
+	for _, itemErr := range itemsErr.Items {
+		indexes = append(indexes, itemErr.Index)
+	}
+	if fmt.Sprint(indexes) != "[1 2 4]" {
+		t.Errorf("tolerant: invalid item indexes = %v, want [1 2 4]", indexes)
+	}
+
+	// 整个字符串无效时两种模式都不返回任何项
+	items, err = internal.ParseCheckMsgV3Mode("short", internal.CheckMsgV3Tolerant)
+	if items != nil || err == nil || errors.As(err, &itemsErr) {
+		t.Errorf("tolerant short: %v, %v", items, err)
+	}
+}
+
+// TestNewCheckMsgV3Item 检查不能写入 checkMsgV3 的文件名被拒绝
+func TestNewCheckMsgV3Item(t *testing.T) {
+	for _, name := range []string{"a_b.tar", "备份.tar"} {
+		item, err := internal.NewCheckMsgV3Item(name)
+		if err != nil {
+			t.Errorf("NewCheckMsgV3Item(%q): %v", name, err)
+			continue
+		}
+		item.ExpectedHmac = make([]byte, 32)
+		items, err := internal.ParseCheckMsgV3(item.String())
+		if err != nil || items[0].FileName != name {
+			t.Errorf("round trip %q: %v, %v", name, items, err)
+		}
+	}
+	for _, name := range []string{"", "a**b.tar", "../a.tar", "a/b.tar", "\xff.tar"} {
+		_, err := internal.NewCheckMsgV3Item(name)
+		if err == nil {
+			t.Errorf("NewCheckMsgV3Item(%q) should fail", name)
+		}
+	}
+}
+
+// FuzzParseCheckMsgV3 检查任意输入都不会 panic，解析成功的结果可以原样格式化
+func FuzzParseCheckMsgV3(f *testing.F) {
+	f.Add(sampleCheckMsgV3Item)
+	f.Add(sampleCheckMsgV3Item + "**" + sampleCheckMsgV3Item)
+	f.Add(sampleCheckMsgV3Item + "**")
+	f.Add(strings.Repeat("0", 128) + "_")
+	f.Add(strings.Repeat("0", 128) + "_a_b.tar")
+	f.Add(strings.Repeat("0", 128) + "_../info.xml")
+	f.Add(strings.Repeat("g", 128) + "_a.tar")
+	f.Add("")
+
+	f.Add(strings.Repeat("0", 128) + "_a_b.tar**" + strings.Repeat("0", 127) + "_c.tar")
+	f.Add(strings.Repeat("0", 128) + "_微信.tar")
+
+	f.Fuzz(func(t *testing.T, checkMsgV3 string) {
+		tolerant, tolerantErr := internal.ParseCheckMsgV3Mode(checkMsgV3, internal.CheckMsgV3Tolerant)
+		items, err := internal.ParseCheckMsgV3(checkMsgV3)
+		if (err == nil) != (tolerantErr == nil) || (err == nil && len(items) != len(tolerant)) {
+			t.Fatalf("strict = %d items, %v, tolerant = %d items, %v", len(items), err, len(tolerant), tolerantErr)
+		}
+		if err != nil {
+			return
+		}
+		for _, item := range items {
+			if len(item.ExpectedHmac) != 32 || len(item.Salt) != internal.SaltLength {
+				t.Fatalf("item %q has %d bytes hmac and %d bytes salt", item, len(item.ExpectedHmac), len(item.Salt))
+			}
+			if strings.ContainsAny(item.FileName, `/\`) || item.FileName == "." || item.FileName == ".." {
+				t.Fatalf("file name %q is not a plain file name", item.FileName)
+			}
+		}
+		if got := internal.FormatCheckMsgV3(items); !strings.EqualFold(got, checkMsgV3) {
+			t.Fatalf("FormatCheckMsgV3 = %q, want %q", got, checkMsgV3)
+		}
+	})
+}
@@ -1,8 +1,23 @@
 package internal
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// Pbkdf2Iterations the pbkdf2 iterations used by kobackup
+	Pbkdf2Iterations = 5000
+	// AesKeyLength 32 bytes key is aes-256
+	AesKeyLength = 32
+	// SaltLength the salt length in encMsgV3 and checkMsgV3
+	SaltLength = 32
+	// IvLength the iv length in encMsgV3
+	IvLength = 16
 )
 
 type EncMsgV3 struct {
@@ -33,3 +48,31 @@ func ParseEncMsgV3(password string, encMsgV3 string) (r EncMsgV3, err error) {
 
 	return r, nil
 }
+
+// NewEncMsgV3 generate a random salt and iv
+func NewEncMsgV3() (r EncMsgV3, err error) {
+	r.Salt = make([]byte, SaltLength)
+	r.Iv = make([]byte, IvLength)
+	_, err = rand.Read(r.Salt)
+	if err != nil {
+		return r, err
+	}
+	_, err = rand.Read(r.Iv)
+	if err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// String format the encMsgV3 as stored in info.xml, salt and iv in lowercase hex
+func (e EncMsgV3) String() string {
+	return hex.EncodeToString(e.Salt) + hex.EncodeToString(e.Iv)
+}
+
+// DeriveKey derive the aes key from password and encMsgV3 salt
+//
+//	password string the password
+//	r1 []byte aesKey
+func (e EncMsgV3) DeriveKey(password string) []byte {
+	return pbkdf2.Key([]byte(password), e.Salt, Pbkdf2Iterations, AesKeyLength, sha256.New)
+}
@@ -0,0 +1,30 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+)
+
+// FuzzParseEncMsgV3 检查任意输入都不会 panic，解析成功的结果可以原样格式化
+func FuzzParseEncMsgV3(f *testing.F) {
+	f.Add(strings.Repeat("0123456789abcdef", 6))
+	f.Add(strings.Repeat("0123456789ABCDEF", 6))
+	f.Add(strings.Repeat("0", 95))
+	f.Add(strings.Repeat("z", 96))
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, encMsgV3 string) {
+		e, err := internal.ParseEncMsgV3("", encMsgV3)
+		if err != nil {
+			return
+		}
+		if len(e.Salt) != internal.SaltLength || len(e.Iv) != internal.IvLength {
+			t.Fatalf("%d bytes salt and %d bytes iv", len(e.Salt), len(e.Iv))
+		}
+		if got := e.String(); !strings.EqualFold(got, encMsgV3) {
+			t.Fatalf("String = %q, want %q", got, encMsgV3)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OutputPath 计算条目在 outDir 下的输出路径，拒绝跳出 outDir 的路径
+func OutputPath(outDir string, name string) (string, error) {
+	localName := filepath.FromSlash(CleanName(name))
+	if !filepath.IsLocal(localName) {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	return filepath.Join(outDir, localName), nil
+}
+
+// WriteEntry 把条目数据 r 写入 outDir 下对应的路径
+func WriteEntry(r io.Reader, entry Entry, outDir string) error {
+	if entry.Typeflag == tar.TypeDir && CleanName(entry.Name) == "" {
+		// 根目录
+		return nil
+	}
+
+	outPath, err := OutputPath(outDir, entry.Name)
+	if err != nil {
+		return err
+	}
+
+	switch entry.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(outPath, 0755)
+	case tar.TypeReg:
+	default:
+		// 链接和设备文件不写出，避免写到 outDir 之外
+		return fmt.Errorf("unsupported entry type: %q", entry.Typeflag)
+	}
+
+	err = os.MkdirAll(filepath.Dir(outPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, entry.Mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(outFile, r)
+	if err != nil {
+		outFile.Close()
+		return err
+	}
+	err = outFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(outPath, entry.ModTime, entry.ModTime)
+}
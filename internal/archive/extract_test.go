@@ -0,0 +1,28 @@
+package archive_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+)
+
+// TestOutputPath 检查输出路径不会跳出输出目录
+func TestOutputPath(t *testing.T) {
+	outDir := filepath.Join("out", "dir")
+
+	cases := map[string]bool{
+		"data/data/com.tencent.mm/a.db":   true,
+		"./data/data/com.tencent.mm/a.db": true,
+		"/data/data/com.tencent.mm/a.db":  true,
+		"../a.db":                         false,
+		"data/../../a.db":                 false,
+		"":                                false,
+	}
+	for name, ok := range cases {
+		_, err := archive.OutputPath(outDir, name)
+		if (err == nil) != ok {
+			t.Errorf("OutputPath(%q) err = %v, want ok = %v", name, err, ok)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IndexVersion 索引文件格式版本，格式变化时递增
+const IndexVersion = 2
+
+// ErrIndexVersion 索引文件由其他版本生成
+var ErrIndexVersion = errors.New("unsupported index version")
+
+// Index 是一个分片的 tar 条目索引
+type Index struct {
+	Version      int       `json:"version"`
+	Chunk        string    `json:"chunk"`        // 分片文件名
+	ChunkSize    int64     `json:"chunkSize"`    // 分片文件大小
+	ChunkModTime time.Time `json:"chunkModTime"` // 分片文件的修改时间
+	Hmac         string    `json:"hmac"`         // 分片的 checkMsgV3 HMAC（hex）
+	Entries      []Entry   `json:"entries"`
+}
+
+// BuildIndex 遍历明文 tar 流并生成索引条目
+func BuildIndex(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	err := List(r, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LoadIndex 读取索引文件
+func LoadIndex(path string) (*Index, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var index Index
+	err = json.Unmarshal(content, &index)
+	if err != nil {
+		return nil, err
+	}
+	if index.Version != IndexVersion {
+		return nil, ErrIndexVersion
+	}
+	return &index, nil
+}
+
+// Save 写入索引文件，先写临时文件再重命名，避免留下损坏的索引
+func (index *Index) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
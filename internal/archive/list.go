@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Entry 表示 tar 中的一个条目
+type Entry struct {
+	Name     string      `json:"name"`               // 条目路径
+	Size     int64       `json:"size"`               // 文件大小
+	Mode     fs.FileMode `json:"mode"`               // 权限与类型
+	ModTime  time.Time   `json:"mtime"`              // 修改时间
+	Typeflag byte        `json:"type"`               // tar 类型标记
+	Linkname string      `json:"linkname,omitempty"` // 链接目标
+
+	HeaderOffset int64 `json:"headerOffset"` // 头部在明文 tar 中的偏移（包含 PAX/GNU 扩展头）
+	DataOffset   int64 `json:"dataOffset"`   // 数据在明文 tar 中的偏移
+}
+
+// List 遍历 tar 流中的所有条目
+//
+// 条目数据会被读取并丢弃，同时记录每个条目的偏移
+func List(r io.Reader, fn func(Entry) error) error {
+	return Walk(r, func(entry Entry, _ io.Reader) error {
+		return fn(entry)
+	})
+}
+
+// Walk 与 List 相同，fn 还可以从 data 读取条目数据，没有读完的部分会被丢弃
+func Walk(r io.Reader, fn func(entry Entry, data io.Reader) error) error {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	var headerOffset int64
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := newEntry(hdr)
+		entry.HeaderOffset = headerOffset
+		entry.DataOffset = cr.n
+
+		err = fn(entry, tr)
+		if err != nil {
+			return err
+		}
+
+		// 读完数据后对齐到 512 字节就是下一个头部的偏移
+		_, err = io.Copy(io.Discard, tr)
+		if err != nil {
+			return err
+		}
+		headerOffset = alignBlock(cr.n)
+	}
+}
+
+// countingReader 记录已读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func alignBlock(n int64) int64 {
+	const blockSize = 512
+	return (n + blockSize - 1) / blockSize * blockSize
+}
+
+func newEntry(hdr *tar.Header) Entry {
+	return Entry{
+		Name:     hdr.Name,
+		Size:     hdr.Size,
+		Mode:     hdr.FileInfo().Mode(),
+		ModTime:  hdr.ModTime,
+		Typeflag: hdr.Typeflag,
+		Linkname: hdr.Linkname,
+	}
+}
+
+// CleanName 去掉条目路径开头的 "./" 和 "/"，便于匹配
+func CleanName(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	return strings.TrimLeft(name, "/")
+}
+
+// Match 判断条目路径是否匹配 glob
+//
+// 空 pattern 匹配所有条目
+func Match(pattern string, name string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	return path.Match(CleanName(pattern), CleanName(name))
+}
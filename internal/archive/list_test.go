@@ -0,0 +1,56 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+)
+
+// TestListOffsets 检查 List 记录的偏移能直接定位到条目数据
+func TestListOffsets(t *testing.T) {
+	files := map[string]string{
+		"data/data/com.tencent.mm/a.db": "hello",
+		// 超过 100 字节的路径会产生 PAX 扩展头
+		"data/data/com.tencent.mm/" + strings.Repeat("long/", 30) + "b.db": strings.Repeat("x", 1000),
+		"data/data/com.tencent.mm/empty":                                   "",
+	}
+	names := []string{
+		"data/data/com.tencent.mm/a.db",
+		"data/data/com.tencent.mm/" + strings.Repeat("long/", 30) + "b.db",
+		"data/data/com.tencent.mm/empty",
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[name]))
+	}
+	tw.Close()
+	plain := buf.Bytes()
+
+	entries, err := archive.BuildIndex(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("BuildIndex: %v", err)
+	}
+	if len(entries) != len(names) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(names))
+	}
+
+	for i, entry := range entries {
+		data := string(plain[entry.DataOffset : entry.DataOffset+entry.Size])
+		if data != files[entry.Name] {
+			t.Errorf("%s: data at offset %d mismatch", entry.Name, entry.DataOffset)
+		}
+
+		// 从头部偏移开始读取应该得到同一个条目
+		tr := tar.NewReader(bytes.NewReader(plain[entry.HeaderOffset:]))
+		hdr, err := tr.Next()
+		if err != nil || hdr.Name != names[i] {
+			t.Errorf("%s: header at offset %d = %v, %v", entry.Name, entry.HeaderOffset, hdr, err)
+		}
+	}
+}
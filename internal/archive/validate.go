@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"io"
+)
+
+// Validator 检查写入的内容是完整的 tar 流，内容读取后丢弃
+//
+// tar 出错后剩余的内容照常丢弃，Write 不会因此失败，写入方可以继续完成其他校验
+type Validator struct {
+	pw      *io.PipeWriter
+	done    chan struct{}
+	entries int
+	err     error
+}
+
+// NewValidator 创建 Validator，使用后必须调用 Close
+func NewValidator() *Validator {
+	pr, pw := io.Pipe()
+	v := &Validator{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(v.done)
+		v.err = List(pr, func(Entry) error {
+			v.entries++
+			return nil
+		})
+		// tar 结束或出错后继续读取，写入方不会阻塞
+		io.Copy(io.Discard, pr)
+	}()
+	return v
+}
+
+func (v *Validator) Write(p []byte) (int, error) {
+	return v.pw.Write(p)
+}
+
+// Close 结束写入，返回 tar 中的条目数和结构错误
+func (v *Validator) Close() (int, error) {
+	v.pw.Close()
+	<-v.done
+	return v.entries, v.err
+}
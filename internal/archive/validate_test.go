@@ -0,0 +1,53 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+)
+
+// TestValidator 检查 Validator 接受完整的 tar，拒绝截断或损坏的 tar，并且总是读完写入的内容
+func TestValidator(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"data/data/com.tencent.mm/a.db", "data/data/com.tencent.mm/b.db"} {
+		content := strings.Repeat("x", 1000)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	plain := buf.Bytes()
+
+	corrupted := bytes.Clone(plain)
+	// 头部校验和不再匹配
+	corrupted[10] ^= 0xff
+
+	cases := []struct {
+		name    string
+		data    []byte
+		entries int
+		ok      bool
+	}{
+		{"complete", plain, 2, true},
+		{"trailing data", append(bytes.Clone(plain), make([]byte, 4096)...), 2, true},
+		{"truncated", plain[:1200], 1, false},
+		{"corrupted header", corrupted, 0, false},
+	}
+	for _, c := range cases {
+		v := archive.NewValidator()
+		// 分多次写入，出错后的写入也不能阻塞
+		for i := 0; i < len(c.data); i += 100 {
+			n, err := v.Write(c.data[i:min(i+100, len(c.data))])
+			if err != nil || n != min(100, len(c.data)-i) {
+				t.Fatalf("%s: Write = %d, %v", c.name, n, err)
+			}
+		}
+		entries, err := v.Close()
+		if (err == nil) != c.ok || entries != c.entries {
+			t.Errorf("%s: Close = %d, %v", c.name, entries, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// Backup 表示一个备份目录
+type Backup struct {
+	Dir     string                         // 备份目录
+	InfoXml *infoxml.InfoXml               // 解析后的 info.xml
+	Modules []infoxml.BackupFileModuleInfo // 模块信息
+}
+
+// Open 打开备份目录并解析 info.xml
+func Open(dir string) (*Backup, error) {
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fileInfo.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", dir)
+	}
+
+	infoXml, err := infoxml.Parse(filepath.Join(dir, "info.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("parse info.xml: %w", err)
+	}
+	modules, err := infoXml.GetBackupFileModuleInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backup{
+		Dir:     dir,
+		InfoXml: infoXml,
+		Modules: modules,
+	}, nil
+}
+
+// Module 根据包名查找模块
+func (b *Backup) Module(name string) (*infoxml.BackupFileModuleInfo, error) {
+	for i := range b.Modules {
+		if b.Modules[i].Name == name {
+			return &b.Modules[i], nil
+		}
+	}
+	return nil, fmt.Errorf("module not found: %s", name)
+}
+
+// SelectModules 返回指定包名的模块，name 为空时返回全部模块
+func (b *Backup) SelectModules(name string) ([]infoxml.BackupFileModuleInfo, error) {
+	if name == "" {
+		return b.Modules, nil
+	}
+	module, err := b.Module(name)
+	if err != nil {
+		return nil, err
+	}
+	return []infoxml.BackupFileModuleInfo{*module}, nil
+}
+
+// ModuleDir 返回模块的应用数据目录
+func (b *Backup) ModuleDir(name string) string {
+	return filepath.Join(b.Dir, name+"_appDataTar")
+}
+
+// ChunkFiles 返回模块目录下所有 .tar 分片文件，按路径排序
+func (b *Backup) ChunkFiles(name string) ([]string, error) {
+	var chunks []string
+	err := filepath.WalkDir(b.ModuleDir(name), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".tar") {
+			return nil
+		}
+		chunks = append(chunks, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(chunks)
+	return chunks, nil
+}
+
+// ModuleKey 解析模块的 encMsgV3 并派生 AES 密钥
+//
+//	r1 []byte aesKey
+//	r2 []byte iv
+//	r3 error
+func ModuleKey(password string, module infoxml.BackupFileModuleInfo) ([]byte, []byte, error) {
+	encMsgV3, err := internal.ParseEncMsgV3(password, module.EncMsgV3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ParseEncMsgV3 Failed for %s: %w", module.Name, err)
+	}
+	return encMsgV3.DeriveKey(password), encMsgV3.Iv, nil
+}
@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// IndexDirName 默认索引目录的名字
+const IndexDirName = ".kobackup-index"
+
+// DefaultIndexDir 默认的索引目录，位于备份目录下
+func (b *Backup) DefaultIndexDir() string {
+	return filepath.Join(b.Dir, IndexDirName)
+}
+
+// ErrIndexStale 索引与分片不一致，需要重建
+var ErrIndexStale = errors.New("index is out of date")
+
+// ErrChunkHmacMismatch 分片的 HMAC 与 checkMsgV3 不一致
+var ErrChunkHmacMismatch = errors.New("checkMsgV3 hash mismatch")
+
+// ChunkItems 返回模块中每个分片文件名对应的 checkMsgV3 项
+func ChunkItems(module infoxml.BackupFileModuleInfo) (map[string]internal.CheckMsgV3Item, error) {
+	// 无效的项对应的分片没有 HMAC，不使用索引
+	items, err := internal.ParseCheckMsgV3Mode(module.CheckMsgV3, internal.CheckMsgV3Tolerant)
+	var itemsErr *internal.CheckMsgV3Error
+	if err != nil && !errors.As(err, &itemsErr) {
+		return nil, err
+	}
+
+	byName := make(map[string]internal.CheckMsgV3Item, len(items))
+	for _, item := range items {
+		byName[item.FileName] = item
+	}
+	return byName, nil
+}
+
+// ChunkHmacs 返回模块中每个分片文件名对应的 checkMsgV3 HMAC
+func ChunkHmacs(module infoxml.BackupFileModuleInfo) (map[string][]byte, error) {
+	items, err := ChunkItems(module)
+	if err != nil {
+		return nil, err
+	}
+
+	hmacs := make(map[string][]byte, len(items))
+	for name, item := range items {
+		hmacs[name] = item.ExpectedHmac
+	}
+	return hmacs, nil
+}
+
+// IndexPath 返回分片索引的路径，索引文件以分片的 checkMsgV3 HMAC 命名
+func IndexPath(indexDir string, hmac []byte) string {
+	return filepath.Join(indexDir, hex.EncodeToString(hmac)+".json")
+}
+
+// LoadChunkIndex 读取分片的索引
+//
+// hmac 为 nil 或索引不存在时返回 nil, nil。索引由其他版本生成，或者分片的 HMAC、文件名、
+// 大小、修改时间与索引记录不一致时返回 ErrIndexStale，调用者应该重建索引
+func LoadChunkIndex(indexDir string, hmac []byte, chunkPath string) (*archive.Index, error) {
+	if hmac == nil {
+		return nil, nil
+	}
+
+	index, err := archive.LoadIndex(IndexPath(indexDir, hmac))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case errors.Is(err, archive.ErrIndexVersion):
+		return nil, ErrIndexStale
+	case err != nil:
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(chunkPath)
+	if err != nil {
+		return nil, err
+	}
+	if index.Hmac != hex.EncodeToString(hmac) ||
+		index.Chunk != filepath.Base(chunkPath) ||
+		index.ChunkSize != fileInfo.Size() ||
+		!index.ChunkModTime.Equal(fileInfo.ModTime()) {
+		return nil, ErrIndexStale
+	}
+	return index, nil
+}
+
+// ScanChunk 流式解密分片并遍历 tar 条目，同时校验 GCM tag 和 checkMsgV3 HMAC，返回分片的索引
+//
+// fn 可以为 nil，也可以读取条目数据；这时数据还没有经过认证，ScanChunk 返回错误时调用者需要丢弃 fn 的结果。
+// item 为 nil 时不校验 HMAC，返回的索引没有 HMAC，不能保存
+func ScanChunk(chunkPath string, key []byte, iv []byte, item *internal.CheckMsgV3Item, password string, fn func(entry archive.Entry, data io.Reader) error) (*archive.Index, error) {
+	in, err := os.Open(chunkPath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	// 先记录分片的大小和修改时间，扫描期间分片被修改时索引会失效
+	fileInfo, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	index := &archive.Index{
+		Version:      archive.IndexVersion,
+		Chunk:        filepath.Base(chunkPath),
+		ChunkSize:    fileInfo.Size(),
+		ChunkModTime: fileInfo.ModTime(),
+	}
+
+	var mac hash.Hash
+	if item != nil {
+		mac = item.NewHmac(password)
+		index.Hmac = hex.EncodeToString(item.ExpectedHmac)
+	}
+
+	result, err := utils.DecryptVerifyReader(in, key, iv, utils.ALGO_AES_GCM, mac, func(plain io.Reader) error {
+		return archive.Walk(plain, func(entry archive.Entry, data io.Reader) error {
+			index.Entries = append(index.Entries, entry)
+			if fn == nil {
+				return nil
+			}
+			return fn(entry, data)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.TagErr != nil {
+		return nil, fmt.Errorf("GCM tag verification failed: %w", result.TagErr)
+	}
+	if item != nil && !item.Verify(result.Hmac) {
+		return nil, ErrChunkHmacMismatch
+	}
+	return index, nil
+}
+
+// SaveChunkIndex 写入 ScanChunk 返回的索引
+func SaveChunkIndex(indexDir string, index *archive.Index) error {
+	hmac, err := hex.DecodeString(index.Hmac)
+	if err != nil || len(hmac) == 0 {
+		return errors.New("index has no checkMsgV3 HMAC")
+	}
+	return index.Save(IndexPath(indexDir, hmac))
+}
@@ -0,0 +1,139 @@
+package backup_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+)
+
+// TestChunkIndex 检查建立、读取索引，以及分片被修改后索引失效
+func TestChunkIndex(t *testing.T) {
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := backup.Open(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := b.Module("com.tencent.mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, iv, err := backup.ModuleKey(f.Password, *module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := backup.ChunkItems(*module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := b.ChunkFiles(module.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := chunks[0]
+	rel := module.Name + "_appDataTar/" + filepath.Base(chunk)
+	item := items[filepath.Base(chunk)]
+	indexDir := b.DefaultIndexDir()
+
+	// 还没有索引
+	index, err := backup.LoadChunkIndex(indexDir, item.ExpectedHmac, chunk)
+	if index != nil || err != nil {
+		t.Fatalf("LoadChunkIndex before indexing = %v, %v", index, err)
+	}
+
+	// 扫描时可以读取条目数据
+	contents := map[string]string{}
+	index, err = backup.ScanChunk(chunk, key, iv, &item, f.Password, func(entry archive.Entry, data io.Reader) error {
+		content, err := io.ReadAll(data)
+		contents[entry.Name] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Entries) != len(f.Entries[rel]) {
+		t.Fatalf("got %d entries, want %d", len(index.Entries), len(f.Entries[rel]))
+	}
+	for name, content := range f.Entries[rel] {
+		if contents[name] != string(content) {
+			t.Errorf("%s: content mismatch", name)
+		}
+	}
+
+	err = backup.SaveChunkIndex(indexDir, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := backup.LoadChunkIndex(indexDir, item.ExpectedHmac, chunk)
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadChunkIndex = %v, %v", loaded, err)
+	}
+	for i, entry := range loaded.Entries {
+		want := index.Entries[i]
+		if entry.Name != want.Name || entry.DataOffset != want.DataOffset || entry.Size != want.Size {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+		}
+	}
+
+	// 大小不变的修改也会使索引失效
+	content, err := os.ReadFile(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)/2] ^= 0xff
+	err = os.WriteFile(chunk, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 文件系统的时间精度可能比写入间隔粗，明确修改时间
+	later := index.ChunkModTime.Add(time.Second)
+	err = os.Chtimes(chunk, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = backup.LoadChunkIndex(indexDir, item.ExpectedHmac, chunk)
+	if !errors.Is(err, backup.ErrIndexStale) {
+		t.Errorf("LoadChunkIndex after modifying the chunk = %v, want ErrIndexStale", err)
+	}
+
+	// 被修改的分片不能重建索引
+	_, err = backup.ScanChunk(chunk, key, iv, &item, f.Password, nil)
+	if err == nil {
+		t.Errorf("ScanChunk on a modified chunk succeeded")
+	}
+
+	// 同一模块的其他分片 GCM tag 正确，但 HMAC 不匹配
+	other := path.Join(module.Name+"_appDataTar", filepath.Base(chunks[1]))
+	_, err = backup.ScanChunk(filepath.Join(f.Dir, filepath.FromSlash(other)), key, iv, &item, f.Password, nil)
+	if !errors.Is(err, backup.ErrChunkHmacMismatch) {
+		t.Errorf("ScanChunk with another chunk's checkMsgV3 item = %v, want ErrChunkHmacMismatch", err)
+	}
+
+	// 其他版本的索引需要重建
+	old := *loaded
+	old.Version = archive.IndexVersion - 1
+	err = old.Save(backup.IndexPath(indexDir, item.ExpectedHmac))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = backup.LoadChunkIndex(indexDir, item.ExpectedHmac, chunk)
+	if !errors.Is(err, backup.ErrIndexStale) {
+		t.Errorf("LoadChunkIndex with an old version = %v, want ErrIndexStale", err)
+	}
+
+	// 没有 HMAC 的索引不能保存
+	index.Hmac = ""
+	if err := backup.SaveChunkIndex(indexDir, index); err == nil {
+		t.Errorf("SaveChunkIndex without HMAC succeeded")
+	}
+}
@@ -0,0 +1,323 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
+)
+
+// KeyFileVersion keyfile 格式的版本
+const KeyFileVersion = 1
+
+// keyFileIterations 加密 keyfile 时 passphrase 的 pbkdf2 迭代次数
+const keyFileIterations = 600000
+
+// maxKeyFileIterations 读取 keyfile 时允许的最大迭代次数，避免构造的 keyfile 长时间占用 CPU
+const maxKeyFileIterations = 10 * keyFileIterations
+
+// maxKeyFileSize keyfile 的最大大小，每个分片只有一个 HMAC 密钥
+const maxKeyFileSize = 16 << 20
+
+// ErrKeyFileMismatch keyfile 属于另一个备份
+var ErrKeyFileMismatch = errors.New("keyfile belongs to a different backup")
+
+// KeyFile 保存一个备份中每个模块派生出的密钥，不需要密码就能解密和校验
+type KeyFile struct {
+	Version  int          `json:"version"`
+	BackupId string       `json:"backupId"` // 见 Backup.ID
+	Modules  []ModuleKeys `json:"modules"`
+}
+
+// ModuleKeys 一个模块派生出的密钥
+type ModuleKeys struct {
+	Name     string            `json:"name"`
+	EncMsgV3 string            `json:"encMsgV3"`
+	AesKey   string            `json:"aesKey"`             // hex 编码的 AES 密钥
+	HmacKeys map[string]string `json:"hmacKeys,omitempty"` // 分片文件名对应的 HMAC 密钥，即 hex 编码的 pbkdf2 输出
+}
+
+// encryptedKeyFile 用 passphrase 加密的 keyfile
+type encryptedKeyFile struct {
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"` // AES-256-GCM 加密的 KeyFile JSON
+}
+
+// ID 标识一个备份，由每个模块的名称、encMsgV3 和 checkMsgV3 计算
+//
+// 修改密码后 encMsgV3 和 checkMsgV3 都会变化，旧的 keyfile 随之失效
+func (b *Backup) ID() string {
+	h := sha256.New()
+	for _, module := range b.Modules {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", module.Name, module.EncMsgV3, module.CheckMsgV3)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DeriveKeys 用密码派生 modules 的 AES 密钥和每个分片的 HMAC 密钥
+//
+// 先用 CheckPassword 检查密码，不匹配时返回 ErrWrongPassword，避免写出只能解密出乱码的 keyfile。
+// 没有 encMsgV3 的模块会被跳过，没有 checkMsgV3 的模块没有 HMAC 密钥
+func (b *Backup) DeriveKeys(password string, modules []infoxml.BackupFileModuleInfo) (*KeyFile, error) {
+	err := b.CheckPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := &KeyFile{
+		Version:  KeyFileVersion,
+		BackupId: b.ID(),
+		Modules:  []ModuleKeys{},
+	}
+
+	for _, module := range modules {
+		if module.EncMsgV3 == "" {
+			continue
+		}
+		key, _, err := ModuleKey(password, module)
+		if err != nil {
+			return nil, err
+		}
+		moduleKeys := ModuleKeys{
+			Name:     module.Name,
+			EncMsgV3: module.EncMsgV3,
+			AesKey:   hex.EncodeToString(key),
+		}
+
+		if module.CheckMsgV3 != "" {
+			// 无效的项没有 HMAC 密钥，解密时不校验对应的文件
+			items, err := internal.ParseCheckMsgV3Mode(module.CheckMsgV3, internal.CheckMsgV3Tolerant)
+			var itemsErr *internal.CheckMsgV3Error
+			if err != nil && !errors.As(err, &itemsErr) {
+				return nil, fmt.Errorf("ParseCheckMsgV3 Failed for %s: %w", module.Name, err)
+			}
+			moduleKeys.HmacKeys = make(map[string]string, len(items))
+			for _, item := range items {
+				moduleKeys.HmacKeys[item.FileName] = string(item.HmacKey(password))
+			}
+		}
+
+		keyFile.Modules = append(keyFile.Modules, moduleKeys)
+	}
+	return keyFile, nil
+}
+
+// Module 根据包名查找模块的密钥
+func (k *KeyFile) Module(name string) *ModuleKeys {
+	for i := range k.Modules {
+		if k.Modules[i].Name == name {
+			return &k.Modules[i]
+		}
+	}
+	return nil
+}
+
+// ModuleByEncMsgV3 根据 encMsgV3 查找模块的密钥
+func (k *KeyFile) ModuleByEncMsgV3(encMsgV3 string) *ModuleKeys {
+	for i := range k.Modules {
+		if k.Modules[i].EncMsgV3 == encMsgV3 {
+			return &k.Modules[i]
+		}
+	}
+	return nil
+}
+
+// ModuleKeys 返回 keyfile 中模块的密钥，并检查 keyfile 属于这个备份
+func (b *Backup) ModuleKeys(k *KeyFile, module infoxml.BackupFileModuleInfo) (*ModuleKeys, error) {
+	if k.BackupId != b.ID() {
+		return nil, ErrKeyFileMismatch
+	}
+	moduleKeys := k.Module(module.Name)
+	if moduleKeys == nil {
+		return nil, fmt.Errorf("module %s not found in keyfile", module.Name)
+	}
+	if moduleKeys.EncMsgV3 != module.EncMsgV3 {
+		return nil, fmt.Errorf("encMsgV3 of %s does not match the keyfile", module.Name)
+	}
+	return moduleKeys, nil
+}
+
+// Key 返回 AES 密钥和 encMsgV3 中的 iv
+//
+//	r1 []byte aesKey
+//	r2 []byte iv
+//	r3 error
+func (m *ModuleKeys) Key() ([]byte, []byte, error) {
+	key, err := hex.DecodeString(m.AesKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("aesKey of %s: %w", m.Name, err)
+	}
+	if len(key) != internal.AesKeyLength {
+		return nil, nil, fmt.Errorf("aesKey of %s must be %d bytes", m.Name, internal.AesKeyLength)
+	}
+	encMsgV3, err := internal.ParseEncMsgV3("", m.EncMsgV3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ParseEncMsgV3 Failed for %s: %w", m.Name, err)
+	}
+	return key, encMsgV3.Iv, nil
+}
+
+// NewHmac 返回校验分片的 hmac-sha256，没有分片的 HMAC 密钥时返回 nil
+func (m *ModuleKeys) NewHmac(fileName string) hash.Hash {
+	hmacKey, ok := m.HmacKeys[fileName]
+	if !ok {
+		return nil
+	}
+	return internal.NewHmacWithKey([]byte(hmacKey))
+}
+
+// Marshal 把 keyfile 编码为 JSON，passphrase 不为空时用它加密
+func (k *KeyFile) Marshal(passphrase string) ([]byte, error) {
+	plain, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return append(plain, '\n'), nil
+	}
+
+	salt := make([]byte, 32)
+	nonce := make([]byte, 12)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := keyFileAead(passphrase, salt, keyFileIterations)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := encryptedKeyFile{
+		Version:    KeyFileVersion,
+		Kdf:        "pbkdf2-sha256",
+		Iterations: keyFileIterations,
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: aead.Seal(nil, nonce, plain, nil),
+	}
+	out, err := json.MarshalIndent(encrypted, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// WriteFile 把 keyfile 写入文件，只有所有者可以读写
+func (k *KeyFile) WriteFile(path string, passphrase string) error {
+	content, err := k.Marshal(passphrase)
+	if err != nil {
+		return err
+	}
+
+	// 先写入 0600 的临时文件再重命名，已经存在的文件不会保留原来较宽的权限
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// ParseKeyFile 解析 keyfile，加密的 keyfile 调用 passphrase 获取密码
+func ParseKeyFile(content []byte, passphrase func() (string, error)) (*KeyFile, error) {
+	if len(content) > maxKeyFileSize {
+		return nil, fmt.Errorf("keyfile is larger than %d bytes", maxKeyFileSize)
+	}
+	var encrypted encryptedKeyFile
+	err := json.Unmarshal(content, &encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("parse keyfile: %w", err)
+	}
+
+	if encrypted.Ciphertext != nil {
+		if encrypted.Kdf != "pbkdf2-sha256" {
+			return nil, fmt.Errorf("unsupported keyfile kdf %q", encrypted.Kdf)
+		}
+		salt, err := hex.DecodeString(encrypted.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("keyfile salt: %w", err)
+		}
+		nonce, err := hex.DecodeString(encrypted.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("keyfile nonce: %w", err)
+		}
+		pass, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		aead, err := keyFileAead(pass, salt, encrypted.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		if len(nonce) != aead.NonceSize() {
+			return nil, errors.New("keyfile nonce has the wrong size")
+		}
+		content, err = aead.Open(nil, nonce, encrypted.Ciphertext, nil)
+		if err != nil {
+			return nil, errors.New("wrong keyfile passphrase or corrupted keyfile")
+		}
+	}
+
+	var keyFile KeyFile
+	err = json.Unmarshal(content, &keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("parse keyfile: %w", err)
+	}
+	if keyFile.Version != KeyFileVersion {
+		return nil, fmt.Errorf("unsupported keyfile version %d", keyFile.Version)
+	}
+	return &keyFile, nil
+}
+
+// ReadKeyFile 读取并解析 keyfile
+func ReadKeyFile(path string, passphrase func() (string, error)) (*KeyFile, error) {
+	content, err := textenc.ReadFileLimit(path, maxKeyFileSize)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyFile(content, passphrase)
+}
+
+func keyFileAead(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 || iterations > maxKeyFileIterations {
+		return nil, fmt.Errorf("invalid keyfile iterations %d", iterations)
+	}
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
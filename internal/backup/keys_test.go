@@ -0,0 +1,142 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// TestKeyFile 检查 keyfile 中的密钥与用密码派生的一致，并且明文和加密的 keyfile 都能读回
+func TestKeyFile(t *testing.T) {
+	module := infoxml.BackupFileModuleInfo{
+		Name:       "com.tencent.mm",
+		EncMsgV3:   strings.Repeat("11", 32) + strings.Repeat("22", 16),
+		CheckMsgV3: strings.Repeat("33", 32) + strings.Repeat("44", 32) + "_com.tencent.mm0.tar",
+	}
+	b := &backup.Backup{Modules: []infoxml.BackupFileModuleInfo{module}}
+
+	keyFile, err := b.DeriveKeys("12345678", b.Modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, passphrase := range []string{"", "correct horse"} {
+		content, err := keyFile.Marshal(passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if passphrase != "" && bytes.Contains(content, []byte(keyFile.Modules[0].AesKey)) {
+			t.Fatal("encrypted keyfile contains the plain aesKey")
+		}
+		parsed, err := backup.ParseKeyFile(content, func() (string, error) { return passphrase, nil })
+		if err != nil {
+			t.Fatalf("ParseKeyFile(passphrase %q): %v", passphrase, err)
+		}
+
+		moduleKeys, err := b.ModuleKeys(parsed, module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, iv, err := moduleKeys.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantKey, wantIv, err := backup.ModuleKey("12345678", module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, wantKey) || !bytes.Equal(iv, wantIv) {
+			t.Errorf("Key() = %X, %X, want %X, %X", key, iv, wantKey, wantIv)
+		}
+
+		items, err := internal.ParseCheckMsgV3(module.CheckMsgV3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac := moduleKeys.NewHmac(items[0].FileName)
+		if mac == nil {
+			t.Fatal("NewHmac() = nil")
+		}
+		wantMac := items[0].NewHmac("12345678")
+		mac.Write([]byte("chunk"))
+		wantMac.Write([]byte("chunk"))
+		if !bytes.Equal(mac.Sum(nil), wantMac.Sum(nil)) {
+			t.Error("HMAC from keyfile differs from HMAC from password")
+		}
+	}
+
+	encrypted, err := keyFile.Marshal("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = backup.ParseKeyFile(encrypted, func() (string, error) { return "wrong", nil })
+	if err == nil {
+		t.Error("ParseKeyFile with a wrong passphrase succeeded")
+	}
+
+	// 密码修改后 checkMsgV3 不同，keyfile 不再适用
+	other := &backup.Backup{Modules: []infoxml.BackupFileModuleInfo{module}}
+	other.Modules[0].CheckMsgV3 = strings.Repeat("55", 64) + "_com.tencent.mm0.tar"
+	_, err = other.ModuleKeys(keyFile, other.Modules[0])
+	if !errors.Is(err, backup.ErrKeyFileMismatch) {
+		t.Errorf("ModuleKeys() for another backup = %v, want ErrKeyFileMismatch", err)
+	}
+}
+
+// TestDeriveKeysWrongPassword 检查密码错误时不派生密钥
+func TestDeriveKeysWrongPassword(t *testing.T) {
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := backup.Open(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.DeriveKeys("wrong", b.Modules)
+	if !errors.Is(err, backup.ErrWrongPassword) {
+		t.Errorf("DeriveKeys with a wrong password = %v, want ErrWrongPassword", err)
+	}
+	_, err = b.DeriveKeys(f.Password, b.Modules)
+	if err != nil {
+		t.Errorf("DeriveKeys = %v", err)
+	}
+}
+
+// TestKeyFileWriteFile 检查写入已经存在的 keyfile 时权限收紧为 0600
+func TestKeyFileWriteFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "backup.keys.json")
+	err := os.WriteFile(path, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := &backup.KeyFile{Version: backup.KeyFileVersion, Modules: []backup.ModuleKeys{}}
+	err = keyFile.WriteFile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("keyfile mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
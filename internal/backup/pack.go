@@ -0,0 +1,380 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// packBackupVersion 生成 info.xml 时使用的 backupVersion，与 infoxml.Schemas 中验证过的版本一致
+const packBackupVersion = 29
+
+// Pack 把明文目录打包为加密的备份，写入不存在的目录 outDir
+//
+// inputDir 的结构与 decrypt-dir 的输出相同：<package>_appDataTar 下的 .tar 是明文分片，
+// 每个模块使用新的 encMsgV3，每个分片使用新的 checkMsgV3。其余文件（apk 等）原样复制。
+//
+// inputDir 中有 info.xml 和 backupinfo.ini 时（例如从原备份复制），只修改其中的
+// encMsgV3、checkMsgV3、apk_size、db_size 和 selectDataSize，并为没有记录的模块添加行；
+// 没有时生成只包含必要字段的文件。
+//
+// info.xml 中还有用原密码加密的数据（没有 _appDataTar 的模块，或 checkMsgV3 中分片以外的文件）
+// 时拒绝打包，见 checkUnpackedModules。
+//
+// 失败时删除 outDir。progress 不为 nil 时在加密每个分片前以相对路径调用。
+func Pack(inputDir, outDir, password string, progress func(rel string)) error {
+	if password == "" {
+		return errors.New("password is empty")
+	}
+
+	chunks, err := plainChunks(inputDir)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("no <package>_appDataTar directory with .tar files in %s", inputDir)
+	}
+
+	ix, err := infoxml.Parse(filepath.Join(inputDir, "info.xml"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		ix = newPackInfoXml()
+	case err != nil:
+		return fmt.Errorf("parse info.xml: %w", err)
+	}
+
+	var ini *backupinfo.Ini
+	info, err := backupinfo.Parse(filepath.Join(inputDir, "backupinfo.ini"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		ini = nil
+	case err != nil && info == nil:
+		return fmt.Errorf("parse backupinfo.ini: %w", err)
+	default:
+		// 有类型错误时仍然保留原来的内容
+		ini = info.Ini
+	}
+
+	err = checkUnpackedModules(ix, inputDir, chunks)
+	if err != nil {
+		return err
+	}
+	err = checkOutside(inputDir, outDir)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(outDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = pack(inputDir, outDir, password, chunks, ix, ini, progress)
+	if err != nil {
+		// outDir 是新创建的，失败时整个删除，不留下一半的备份
+		os.RemoveAll(outDir)
+		return err
+	}
+	return nil
+}
+
+func pack(inputDir, outDir, password string, chunks map[string][]string, ix *infoxml.InfoXml, ini *backupinfo.Ini, progress func(string)) error {
+	names := make([]string, 0, len(chunks))
+	for name := range chunks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 已经加密的文件，复制其余文件时跳过
+	encrypted := map[string]bool{}
+	for _, name := range names {
+		encMsgV3, err := internal.NewEncMsgV3()
+		if err != nil {
+			return err
+		}
+		key := encMsgV3.DeriveKey(password)
+
+		items := make([]internal.CheckMsgV3Item, 0, len(chunks[name]))
+		for _, rel := range chunks[name] {
+			if progress != nil {
+				progress(rel)
+			}
+			item, err := internal.NewCheckMsgV3Item(filepath.Base(rel))
+			if err != nil {
+				return err
+			}
+			mac := item.NewHmac(password)
+			err = encryptFile(filepath.Join(inputDir, rel), filepath.Join(outDir, rel), key, encMsgV3.Iv, mac)
+			if err != nil {
+				return fmt.Errorf("encrypt %s: %w", rel, err)
+			}
+			item.ExpectedHmac = mac.Sum(nil)
+			items = append(items, item)
+			encrypted[rel] = true
+		}
+
+		row := moduleRow(ix, name)
+		if row == nil {
+			row = ix.AddRow("BackupFileModuleInfo")
+			row.SetColumnValue("name", infoxml.StringValue(name))
+		}
+		row.SetColumnValue("encMsgV3", infoxml.StringValue(encMsgV3.String()))
+		row.SetColumnValue("checkMsgV3", infoxml.StringValue(internal.FormatCheckMsgV3(items)))
+	}
+
+	err := copyFiles(inputDir, outDir, func(rel string) bool {
+		return rel == "info.xml" || rel == "backupinfo.ini" || encrypted[rel]
+	})
+	if err != nil {
+		return err
+	}
+
+	// 没有 backupinfo.ini 时把所有模块当作应用
+	if ini == nil {
+		ini = newPackIni(names)
+	}
+	total, err := updateAppSizes(ini, outDir)
+	if err != nil {
+		return err
+	}
+
+	if header := ix.GetFirstRowByTable("HeaderInfo"); header != nil {
+		selectDataSize, _ := header.GetColumnLong("selectDataSize")
+		if selectDataSize < total {
+			header.SetColumnValue("selectDataSize", infoxml.LongValue(total))
+		}
+	}
+
+	err = ini.WriteFile(filepath.Join(outDir, "backupinfo.ini"))
+	if err != nil {
+		return err
+	}
+	return ix.WriteFile(filepath.Join(outDir, "info.xml"))
+}
+
+// plainChunks 返回每个模块 <package>_appDataTar 下的 .tar 文件，路径相对于 inputDir 并排序
+func plainChunks(inputDir string) (map[string][]string, error) {
+	entries, err := os.ReadDir(inputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := map[string][]string{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), "_appDataTar")
+		if !ok || !entry.IsDir() || name == "" {
+			continue
+		}
+		err := filepath.WalkDir(filepath.Join(inputDir, entry.Name()), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.HasSuffix(d.Name(), ".tar") {
+				return nil
+			}
+			rel, err := filepath.Rel(inputDir, path)
+			if err != nil {
+				return err
+			}
+			chunks[name] = append(chunks[name], rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(chunks[name])
+	}
+	return chunks, nil
+}
+
+// encryptFile 用 AES-256-GCM 加密文件，mac 同时计算密文的 HMAC
+func encryptFile(in, out string, key, iv []byte, mac hash.Hash) error {
+	inFile, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+	return writeEncrypted(inFile, out, key, iv, mac)
+}
+
+// writeEncrypted 用 AES-256-GCM 加密 r 的内容写入文件 out，mac 不为 nil 时同时计算密文的 HMAC
+func writeEncrypted(r io.Reader, out string, key, iv []byte, mac hash.Hash) error {
+	err := os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	var sink io.Writer = outFile
+	if mac != nil {
+		sink = io.MultiWriter(outFile, mac)
+	}
+	w, err := utils.NewEncryptWriter(sink, key, iv, utils.ALGO_AES_GCM)
+	if err == nil {
+		_, err = io.Copy(w, r)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	closeErr := outFile.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// updateAppSizes 按 outDir 中的文件更新 backupinfo.ini 中每个应用的 apk_size 和 db_size
+//
+// db_size 是 <package>.db、<package>.tar 和加密分片的大小之和，与 doctor 的检查一致
+//
+//	r1 int64 所有应用 apk_size 与 db_size 之和
+//	r2 error
+func updateAppSizes(ini *backupinfo.Ini, outDir string) (int64, error) {
+	info, _ := backupinfo.ParseString(ini.String())
+	if info == nil {
+		return 0, errors.New("invalid backupinfo.ini")
+	}
+
+	total := int64(0)
+	for _, app := range info.Apps {
+		section := ini.Section(app.PackageName)
+		if section == nil {
+			continue
+		}
+
+		apkSize := fileSize(filepath.Join(outDir, app.PackageName+".apk"))
+		dbSize := fileSize(filepath.Join(outDir, app.PackageName+".db")) + fileSize(filepath.Join(outDir, app.PackageName+".tar"))
+		err := filepath.WalkDir(filepath.Join(outDir, app.PackageName+"_appDataTar"), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ".tar") {
+				dbSize += fileSize(path)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, err
+		}
+
+		section.Set("apk_size", strconv.FormatInt(apkSize, 10))
+		section.Set("db_size", strconv.FormatInt(dbSize, 10))
+		total += apkSize + dbSize
+	}
+	return total, nil
+}
+
+func fileSize(path string) int64 {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fileInfo.Size()
+}
+
+// newPackInfoXml 生成只有 HeaderInfo 的 info.xml，模块行在加密时添加
+func newPackInfoXml() *infoxml.InfoXml {
+	ix := &infoxml.InfoXml{}
+	header := ix.AddRow("HeaderInfo")
+	header.SetColumnValue("backupVersion", infoxml.IntegerValue(packBackupVersion))
+	header.SetColumnValue("dateTime", infoxml.LongValue(time.Now().UnixMilli()))
+	header.SetColumnValue("selectDataSize", infoxml.LongValue(0))
+	return ix
+}
+
+// newPackIni 生成把 names 都当作应用的 backupinfo.ini，应用名使用包名
+func newPackIni(names []string) *backupinfo.Ini {
+	ini := &backupinfo.Ini{Newline: "\r\n"}
+	ini.AddSection("overview").Set("app_info", strings.Join(names, ","))
+	for _, name := range names {
+		ini.AddSection(name).Set("app_name", name)
+	}
+	return ini
+}
+
+// moduleRow 返回 info.xml 中模块的 BackupFileModuleInfo 行，可以用来修改该行
+func moduleRow(ix *infoxml.InfoXml, name string) *infoxml.Row {
+	for i := range ix.Rows {
+		row := &ix.Rows[i]
+		if row.Table != "BackupFileModuleInfo" {
+			continue
+		}
+		if rowName, _ := row.GetColumnString("name"); rowName == name {
+			return row
+		}
+	}
+	return nil
+}
+
+// checkUnpackedModules 检查 info.xml 中用原密码加密的数据都会用新密码重新加密
+//
+// 从原备份复制的 info.xml 中，没有 _appDataTar 的模块（联系人、短信等）和 checkMsgV3 中
+// 分片以外的文件（<package>.db 等）仍然是用原密码加密的。Pack 无法重新加密这些数据，
+// 打包后的备份会混用两个密码，HiSuite 无法恢复
+func checkUnpackedModules(ix *infoxml.InfoXml, inputDir string, chunks map[string][]string) error {
+	var unpacked []string
+	for _, row := range ix.GetRowsByTable("BackupFileModuleInfo") {
+		// 列不存在或类型不符时当作空字符串
+		name, _ := row.GetColumnString("name")
+		encMsgV3, _ := row.GetColumnString("encMsgV3")
+		checkMsgV3, _ := row.GetColumnString("checkMsgV3")
+		if _, ok := chunks[name]; !ok {
+			if encMsgV3 != "" || checkMsgV3 != "" {
+				unpacked = append(unpacked, name)
+			}
+			continue
+		}
+
+		packed := map[string]bool{}
+		for _, rel := range chunks[name] {
+			packed[filepath.Base(rel)] = true
+		}
+		// 无效的条目没有文件名，重新加密后会被替换
+		items, _ := internal.ParseCheckMsgV3Mode(checkMsgV3, internal.CheckMsgV3Tolerant)
+		for _, item := range items {
+			if packed[item.FileName] {
+				continue
+			}
+			_, err := os.Stat(filepath.Join(inputDir, item.FileName))
+			if err == nil {
+				unpacked = append(unpacked, name+"/"+item.FileName)
+			}
+		}
+	}
+	if len(unpacked) > 0 {
+		return fmt.Errorf("cannot re-encrypt data encrypted with the original password: %s; remove these modules from info.xml or their files from %s",
+			strings.Join(unpacked, ", "), inputDir)
+	}
+	return nil
+}
+
+// checkOutside 检查 outDir 不在 dir 中，否则复制文件时会遍历到输出
+func checkOutside(dir, outDir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absDir, absOut)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("output directory %s is inside %s", outDir, dir)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/doctor"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// TestPack 检查打包的备份可以用密码解密，并且 doctor 没有发现错误
+func TestPack(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "plain")
+	files := map[string]string{
+		"com.tencent.mm_appDataTar/com.tencent.mm0.tar": "wechat chunk 0",
+		"com.tencent.mm_appDataTar/com.tencent.mm1.tar": "wechat chunk 1",
+		"com.tencent.mm.apk":                            "apk",
+		"com.example_appDataTar/com.example0.tar":       "example",
+	}
+	for name, content := range files {
+		path := filepath.Join(input, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "packed")
+	err := backup.Pack(input, out, "12345678", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Modules) != 2 {
+		t.Fatalf("got %d modules, want 2", len(b.Modules))
+	}
+	for _, module := range b.Modules {
+		key, iv, err := backup.ModuleKey("12345678", module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hmacs, err := backup.ChunkHmacs(module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := b.ChunkFiles(module.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			rel, _ := filepath.Rel(out, chunk)
+			in, err := os.Open(chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var plain bytes.Buffer
+			result, err := utils.DecryptVerify(in, &plain, key, iv, utils.ALGO_AES_GCM, nil)
+			in.Close()
+			if err != nil || result.TagErr != nil {
+				t.Fatalf("%s: DecryptVerify = %v, %v", rel, err, result.TagErr)
+			}
+			if plain.String() != files[filepath.ToSlash(rel)] {
+				t.Errorf("%s: plaintext = %q", rel, plain.String())
+			}
+			if hmacs[filepath.Base(chunk)] == nil {
+				t.Errorf("%s: no checkMsgV3 entry", rel)
+			}
+		}
+	}
+
+	info, err := backupinfo.Parse(filepath.Join(out, "backupinfo.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := doctor.Check(b, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range findings {
+		t.Errorf("doctor: %s", finding)
+	}
+}
+
+// TestPackUnpackedModules 检查 info.xml 中还有用原密码加密的数据时拒绝打包
+func TestPackUnpackedModules(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "plain")
+	files := map[string]string{
+		"com.tencent.mm_appDataTar/com.tencent.mm0.tar": "wechat chunk 0",
+		"com.tencent.mm.db":                             "old database",
+	}
+	for name, content := range files {
+		path := filepath.Join(input, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunk, err := internal.NewCheckMsgV3Item("com.tencent.mm0.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := internal.NewCheckMsgV3Item("com.tencent.mm.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 原备份中的 HMAC，内容不影响检查
+	chunk.ExpectedHmac = make([]byte, 32)
+	db.ExpectedHmac = make([]byte, 32)
+	encMsgV3, err := internal.NewEncMsgV3()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := &infoxml.InfoXml{}
+	row := ix.AddRow("BackupFileModuleInfo")
+	row.SetColumnValue("name", infoxml.StringValue("com.tencent.mm"))
+	row.SetColumnValue("encMsgV3", infoxml.StringValue(encMsgV3.String()))
+	row.SetColumnValue("checkMsgV3", infoxml.StringValue(internal.FormatCheckMsgV3([]internal.CheckMsgV3Item{chunk, db})))
+	// 联系人没有 _appDataTar
+	row = ix.AddRow("BackupFileModuleInfo")
+	row.SetColumnValue("name", infoxml.StringValue("contact"))
+	row.SetColumnValue("encMsgV3", infoxml.StringValue(encMsgV3.String()))
+	err = ix.WriteFile(filepath.Join(input, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "packed")
+	err = backup.Pack(input, out, "12345678", nil)
+	if err == nil {
+		t.Fatal("Pack succeeded")
+	}
+	for _, want := range []string{"com.tencent.mm/com.tencent.mm.db", "contact"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not name %s", err, want)
+		}
+	}
+	if _, err := os.Stat(out); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("output directory was created: %v", err)
+	}
+
+	// 删除原密码加密的文件和模块后可以打包
+	err = os.Remove(filepath.Join(input, "com.tencent.mm.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.RemoveRows(func(row *infoxml.Row) bool {
+		name, _ := row.GetColumnString("name")
+		return name == "contact"
+	})
+	err = ix.WriteFile(filepath.Join(input, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backup.Pack(input, out, "12345678", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+)
+
+// ErrNoCheckableChunk 备份中没有可以用 checkMsgV3 校验的分片
+var ErrNoCheckableChunk = errors.New("no chunk with a checkMsgV3 entry found")
+
+// PasswordChecker 用 checkMsgV3 中的 HMAC 离线测试候选密码
+//
+// 每个候选密码只需要一次 pbkdf2 和对分片的一次 HMAC，所以选择最小的分片
+type PasswordChecker struct {
+	Module string // 分片所属的模块
+	Path   string // 分片路径
+	Size   int64
+
+	item internal.CheckMsgV3Item
+	file *os.File
+}
+
+// NewPasswordChecker 选择备份中有 checkMsgV3 项的最小分片，用完后需要调用 Close
+func (b *Backup) NewPasswordChecker() (*PasswordChecker, error) {
+	var best *PasswordChecker
+	for _, module := range b.Modules {
+		// 只使用有效的 checkMsgV3 项
+		items, _ := internal.ParseCheckMsgV3Mode(module.CheckMsgV3, internal.CheckMsgV3Tolerant)
+		byName := make(map[string]internal.CheckMsgV3Item, len(items))
+		for _, item := range items {
+			byName[item.FileName] = item
+		}
+
+		chunks, _ := b.ChunkFiles(module.Name)
+		for _, chunk := range chunks {
+			item, ok := byName[filepath.Base(chunk)]
+			if !ok {
+				continue
+			}
+			fileInfo, err := os.Stat(chunk)
+			if err != nil {
+				continue
+			}
+			if best == nil || fileInfo.Size() < best.Size {
+				best = &PasswordChecker{
+					Module: module.Name,
+					Path:   chunk,
+					Size:   fileInfo.Size(),
+					item:   item,
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil, ErrNoCheckableChunk
+	}
+
+	file, err := os.Open(best.Path)
+	if err != nil {
+		return nil, err
+	}
+	best.file = file
+	return best, nil
+}
+
+// CheckPassword 用最小的分片检查 password 是否为备份密码，不匹配时返回 ErrWrongPassword
+//
+// 备份中没有可以校验的分片时不做检查，返回 nil
+func (b *Backup) CheckPassword(password string) error {
+	checker, err := b.NewPasswordChecker()
+	if errors.Is(err, ErrNoCheckableChunk) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer checker.Close()
+
+	ok, err := checker.Check(password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// Close 关闭分片文件
+func (c *PasswordChecker) Close() error {
+	return c.file.Close()
+}
+
+// Check 判断 password 是否为备份密码，可以并发调用
+func (c *PasswordChecker) Check(password string) (bool, error) {
+	mac := c.item.NewHmac(password)
+	_, err := io.Copy(mac, io.NewSectionReader(c.file, 0, c.Size))
+	if err != nil {
+		return false, err
+	}
+	return c.item.Verify(mac.Sum(nil)), nil
+}
+
+// Find 用 workers 个 goroutine 并行测试候选密码，workers 不大于 0 时使用 CPU 核数
+//
+//	r1 string 正确的密码
+//	r2 bool 是否找到
+//	r3 error 读取分片失败
+func (c *PasswordChecker) Find(candidates []string, workers int) (string, bool, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var (
+		next     atomic.Int64
+		done     atomic.Bool
+		once     sync.Once
+		password string
+		found    bool
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	stop := func(p string, ok bool, err error) {
+		once.Do(func() {
+			password, found, firstErr = p, ok, err
+			done.Store(true)
+		})
+	}
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done.Load() {
+				i := next.Add(1) - 1
+				if i >= int64(len(candidates)) {
+					return
+				}
+				ok, err := c.Check(candidates[i])
+				if err != nil {
+					stop("", false, err)
+					return
+				}
+				if ok {
+					stop(candidates[i], true, nil)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return password, found, firstErr
+}
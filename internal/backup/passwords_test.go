@@ -0,0 +1,67 @@
+package backup_test
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// TestPasswordChecker 检查选择最小的分片，并能从候选密码中找出正确的密码
+func TestPasswordChecker(t *testing.T) {
+	dir := t.TempDir()
+	chunkDir := filepath.Join(dir, "com.tencent.mm_appDataTar")
+	err := os.MkdirAll(chunkDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkMsgV3 中的 HMAC 由密码和每个分片的 salt 计算
+	var checkMsgV3 []string
+	for i, content := range []string{strings.Repeat("large", 1000), "small"} {
+		name := []string{"com.tencent.mm0.tar", "com.tencent.mm1.tar"}[i]
+		err = os.WriteFile(filepath.Join(chunkDir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := internal.CheckMsgV3Item{Salt: []byte(strings.Repeat(string(rune('a'+i)), 32))}
+		mac := item.NewHmac("12345678")
+		mac.Write([]byte(content))
+		checkMsgV3 = append(checkMsgV3, hex.EncodeToString(mac.Sum(nil))+hex.EncodeToString(item.Salt)+"_"+name)
+	}
+	b := &backup.Backup{
+		Dir: dir,
+		Modules: []infoxml.BackupFileModuleInfo{
+			{Name: "com.tencent.mm", CheckMsgV3: strings.Join(checkMsgV3, "**")},
+		},
+	}
+
+	checker, err := b.NewPasswordChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Close()
+	if filepath.Base(checker.Path) != "com.tencent.mm1.tar" {
+		t.Errorf("checker uses %s, want the smallest chunk", checker.Path)
+	}
+
+	candidates := []string{"password", "00000000", "12345678", "87654321", "qwerty"}
+	password, found, err := checker.Find(candidates, 3)
+	if err != nil || !found || password != "12345678" {
+		t.Errorf("Find() = %q, %v, %v", password, found, err)
+	}
+	_, found, err = checker.Find(candidates[:2], 0)
+	if err != nil || found {
+		t.Errorf("Find() without the password = %v, %v", found, err)
+	}
+
+	_, err = (&backup.Backup{Dir: dir}).NewPasswordChecker()
+	if err != backup.ErrNoCheckableChunk {
+		t.Errorf("NewPasswordChecker() without modules = %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// ErrWrongPassword 密码与 checkMsgV3 中的 HMAC 不匹配
+var ErrWrongPassword = errors.New("wrong password")
+
+// Repassword 用新密码重新加密备份，写入不存在的目录 outDir，原目录保持不变
+//
+// 每个模块使用新的 encMsgV3，每个分片使用新的 checkMsgV3 salt；旧的 HMAC 和
+// GCM tag 在解密时一并校验。其余文件原样复制，info.xml 中只修改 encMsgV3 和 checkMsgV3，
+// 索引目录不会复制，失败时删除 outDir。progress 不为 nil 时在重新加密每个文件前以相对路径调用。
+//
+// 有 encMsgV3 但没有 checkMsgV3 的模块无法确定哪些文件是加密的，见 checkUnlistedModules
+func (b *Backup) Repassword(oldPassword, newPassword, outDir string, progress func(rel string)) error {
+	if newPassword == "" {
+		return errors.New("new password is empty")
+	}
+
+	err := b.checkUnlistedModules()
+	if err != nil {
+		return err
+	}
+
+	// 先用最小的分片检查旧密码，避免写出一半才发现密码错误
+	err = b.CheckPassword(oldPassword)
+	if err != nil {
+		return err
+	}
+
+	err = checkOutside(b.Dir, outDir)
+	if err != nil {
+		return err
+	}
+
+	// 重新解析 info.xml，不修改 b.InfoXml
+	ix, err := infoxml.Parse(filepath.Join(b.Dir, "info.xml"))
+	if err != nil {
+		return fmt.Errorf("parse info.xml: %w", err)
+	}
+
+	err = os.Mkdir(outDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = b.repassword(ix, oldPassword, newPassword, outDir, progress)
+	if err != nil {
+		// outDir 是新创建的，失败时整个删除，不留下一半的备份
+		os.RemoveAll(outDir)
+		return err
+	}
+	return nil
+}
+
+func (b *Backup) repassword(ix *infoxml.InfoXml, oldPassword, newPassword, outDir string, progress func(string)) error {
+	// 已经重新加密的文件，复制其余文件时跳过
+	encrypted := map[string]bool{}
+	for _, module := range b.Modules {
+		if module.EncMsgV3 == "" {
+			continue
+		}
+		encMsgV3, checkMsgV3, err := b.repasswordModule(module, oldPassword, newPassword, outDir, encrypted, progress)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", module.Name, err)
+		}
+		if row := moduleRow(ix, module.Name); row != nil {
+			row.SetColumnValue("encMsgV3", infoxml.StringValue(encMsgV3))
+			row.SetColumnValue("checkMsgV3", infoxml.StringValue(checkMsgV3))
+		}
+	}
+
+	err := copyFiles(b.Dir, outDir, func(rel string) bool {
+		return rel == "info.xml" || encrypted[rel]
+	})
+	if err != nil {
+		return err
+	}
+	return ix.WriteFile(filepath.Join(outDir, "info.xml"))
+}
+
+// repasswordModule 重新加密模块的分片，以及 checkMsgV3 中列出的备份根目录下的文件
+//
+//	r1 string 新的 encMsgV3
+//	r2 string 新的 checkMsgV3
+//	r3 error
+func (b *Backup) repasswordModule(module infoxml.BackupFileModuleInfo, oldPassword, newPassword, outDir string, encrypted map[string]bool, progress func(string)) (string, string, error) {
+	oldKey, oldIv, err := ModuleKey(oldPassword, module)
+	if err != nil {
+		return "", "", err
+	}
+	newEncMsgV3, err := internal.NewEncMsgV3()
+	if err != nil {
+		return "", "", err
+	}
+	newKey := newEncMsgV3.DeriveKey(newPassword)
+
+	oldItems, err := internal.ParseCheckMsgV3(module.CheckMsgV3)
+	if err != nil {
+		return "", "", fmt.Errorf("ParseCheckMsgV3 Failed: %w", err)
+	}
+
+	// 分片按文件名对应 checkMsgV3 项
+	files := map[string]string{}
+	chunks, err := b.ChunkFiles(module.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+	for _, chunk := range chunks {
+		files[filepath.Base(chunk)] = chunk
+	}
+
+	newItems := make([]internal.CheckMsgV3Item, 0, len(oldItems))
+	for _, oldItem := range oldItems {
+		path, ok := files[oldItem.FileName]
+		if !ok {
+			path = filepath.Join(b.Dir, oldItem.FileName)
+			if _, err := os.Stat(path); err != nil {
+				return "", "", fmt.Errorf("%s is listed in checkMsgV3: %w", oldItem.FileName, err)
+			}
+		}
+		delete(files, oldItem.FileName)
+
+		newItem, err := internal.NewCheckMsgV3Item(oldItem.FileName)
+		if err != nil {
+			return "", "", err
+		}
+		oldHmac, newHmac, err := b.reencryptFile(path, outDir, oldKey, oldIv, oldItem.NewHmac(oldPassword), newKey, newEncMsgV3.Iv, newItem.NewHmac(newPassword), encrypted, progress)
+		if err != nil {
+			return "", "", err
+		}
+		if !oldItem.Verify(oldHmac) {
+			return "", "", fmt.Errorf("%s: checkMsgV3 hash mismatch", path)
+		}
+		newItem.ExpectedHmac = newHmac
+		newItems = append(newItems, newItem)
+	}
+
+	// 没有 checkMsgV3 项的分片也用模块密钥加密
+	for _, chunk := range chunks {
+		if _, ok := files[filepath.Base(chunk)]; !ok {
+			continue
+		}
+		_, _, err := b.reencryptFile(chunk, outDir, oldKey, oldIv, nil, newKey, newEncMsgV3.Iv, nil, encrypted, progress)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return newEncMsgV3.String(), internal.FormatCheckMsgV3(newItems), nil
+}
+
+// checkUnlistedModules 检查每个有 encMsgV3 的模块都有 checkMsgV3
+//
+// checkMsgV3 列出了模块中用 encMsgV3 加密的文件（分片、<package>.db 等），没有时只能找到
+// _appDataTar 下的分片，其他加密的文件会被原样复制，重新加密后的备份会混用两个密码
+func (b *Backup) checkUnlistedModules() error {
+	var unlisted []string
+	for _, module := range b.Modules {
+		if module.EncMsgV3 != "" && module.CheckMsgV3 == "" {
+			unlisted = append(unlisted, module.Name)
+		}
+	}
+	if len(unlisted) > 0 {
+		return fmt.Errorf("cannot tell which files are encrypted with the original password without checkMsgV3: %s",
+			strings.Join(unlisted, ", "))
+	}
+	return nil
+}
+
+// reencryptFile 只读取一次旧密文，解密后用新密钥加密写入 outDir 下的相同位置
+//
+// 旧的 GCM tag 不匹配或出错时删除输出文件
+//
+//	r1 []byte 旧密文的 HMAC，oldMac 为 nil 时为 nil
+//	r2 []byte 新密文的 HMAC，newMac 为 nil 时为 nil
+//	r3 error
+func (b *Backup) reencryptFile(path, outDir string, oldKey, oldIv []byte, oldMac hash.Hash, newKey, newIv []byte, newMac hash.Hash, encrypted map[string]bool, progress func(string)) ([]byte, []byte, error) {
+	rel, err := filepath.Rel(b.Dir, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if progress != nil {
+		progress(rel)
+	}
+	encrypted[rel] = true
+
+	out := filepath.Join(outDir, rel)
+	err = os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+	outFile, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sink io.Writer = outFile
+	if newMac != nil {
+		sink = io.MultiWriter(outFile, newMac)
+	}
+	result, err := reencrypt(in, sink, oldKey, oldIv, oldMac, newKey, newIv)
+	closeErr := outFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && result.TagErr != nil {
+		err = fmt.Errorf("%s: GCM tag: %w", path, result.TagErr)
+	}
+	if err != nil {
+		os.Remove(out)
+		return nil, nil, err
+	}
+
+	var newHmac []byte
+	if newMac != nil {
+		newHmac = newMac.Sum(nil)
+	}
+	return result.Hmac, newHmac, nil
+}
+
+func reencrypt(in io.Reader, out io.Writer, oldKey, oldIv []byte, oldMac hash.Hash, newKey, newIv []byte) (utils.VerifyResult, error) {
+	w, err := utils.NewEncryptWriter(out, newKey, newIv, utils.ALGO_AES_GCM)
+	if err != nil {
+		return utils.VerifyResult{}, err
+	}
+	result, err := utils.DecryptVerify(in, w, oldKey, oldIv, utils.ALGO_AES_GCM, oldMac)
+	if err != nil {
+		return result, err
+	}
+	return result, w.Close()
+}
+
+// copyFiles 把 dir 中的文件复制到 outDir，跳过 skip 返回 true 的文件和索引目录
+func copyFiles(dir, outDir string, skip func(rel string) bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel == IndexDirName {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(outDir, rel), 0755)
+		}
+		if skip(rel) || !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, filepath.Join(outDir, rel))
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fileInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,168 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// TestRepassword 检查重新加密后只能用新密码解密，其余文件原样复制
+func TestRepassword(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	chunkDir := filepath.Join(dir, "com.tencent.mm_appDataTar")
+	err := os.MkdirAll(chunkDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := bytes.Repeat([]byte("tar data "), 1000)
+
+	// 用旧密码加密分片并生成 encMsgV3、checkMsgV3
+	encMsgV3, err := internal.NewEncMsgV3()
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := internal.NewCheckMsgV3Item("com.tencent.mm0.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ciphertext bytes.Buffer
+	w, err := utils.NewEncryptWriter(&ciphertext, encMsgV3.DeriveKey("old"), encMsgV3.Iv, utils.ALGO_AES_GCM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	w.Close()
+	mac := item.NewHmac("old")
+	mac.Write(ciphertext.Bytes())
+	item.ExpectedHmac = mac.Sum(nil)
+
+	err = os.WriteFile(filepath.Join(chunkDir, item.FileName), ciphertext.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "com.tencent.mm.apk"), []byte("apk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoXml := &infoxml.InfoXml{}
+	row := infoXml.AddRow("BackupFileModuleInfo")
+	row.SetColumnValue("name", infoxml.StringValue("com.tencent.mm"))
+	row.SetColumnValue("encMsgV3", infoxml.StringValue(encMsgV3.String()))
+	row.SetColumnValue("checkMsgV3", infoxml.StringValue(internal.FormatCheckMsgV3([]internal.CheckMsgV3Item{item})))
+	err = infoXml.WriteFile(filepath.Join(dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongOut := filepath.Join(t.TempDir(), "wrong")
+	err = b.Repassword("wrong", "new", wrongOut, nil)
+	if !errors.Is(err, backup.ErrWrongPassword) {
+		t.Errorf("Repassword with a wrong password = %v", err)
+	}
+	if _, err := os.Stat(wrongOut); !os.IsNotExist(err) {
+		t.Errorf("output directory exists after a failed Repassword")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = b.Repassword("old", "new", out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nb, err := backup.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := nb.Modules[0]
+	if module.EncMsgV3 == b.Modules[0].EncMsgV3 || module.CheckMsgV3 == b.Modules[0].CheckMsgV3 {
+		t.Error("encMsgV3 or checkMsgV3 was not regenerated")
+	}
+
+	checker, err := nb.NewPasswordChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Close()
+	for password, want := range map[string]bool{"new": true, "old": false} {
+		ok, err := checker.Check(password)
+		if err != nil || ok != want {
+			t.Errorf("Check(%q) = %v, %v, want %v", password, ok, err, want)
+		}
+	}
+
+	key, iv, err := backup.ModuleKey("new", module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decrypted bytes.Buffer
+	chunk, err := os.Open(filepath.Join(out, "com.tencent.mm_appDataTar", "com.tencent.mm0.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chunk.Close()
+	result, err := utils.DecryptVerify(chunk, &decrypted, key, iv, utils.ALGO_AES_GCM, nil)
+	if err != nil || result.TagErr != nil {
+		t.Fatalf("DecryptVerify = %v, %v", err, result.TagErr)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plain) {
+		t.Error("plaintext changed after Repassword")
+	}
+
+	apk, err := os.ReadFile(filepath.Join(out, "com.tencent.mm.apk"))
+	if err != nil || string(apk) != "apk" {
+		t.Errorf("apk was not copied: %q, %v", apk, err)
+	}
+}
+
+// TestRepasswordWithoutCheckMsgV3 检查有 encMsgV3 但没有 checkMsgV3 的模块拒绝重新加密
+func TestRepasswordWithoutCheckMsgV3(t *testing.T) {
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 checkMsgV3 时无法知道 <package>.db 等文件是否加密
+	err = os.WriteFile(filepath.Join(f.Dir, "com.example.notes.db"), []byte("encrypted database"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := infoxml.Parse(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ix.Rows {
+		if name, _ := ix.Rows[i].GetColumnString("name"); ix.Rows[i].Table == "BackupFileModuleInfo" && name == "com.example.notes" {
+			ix.Rows[i].RemoveColumn("checkMsgV3")
+		}
+	}
+	err = ix.WriteFile(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Open(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	err = b.Repassword(f.Password, "new", out, nil)
+	if err == nil || !strings.Contains(err.Error(), "com.example.notes") {
+		t.Errorf("Repassword = %v, want an error naming com.example.notes", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("output directory exists after a refused Repassword")
+	}
+}
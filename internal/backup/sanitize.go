@@ -0,0 +1,343 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// sanitizedColumns Sanitize 替换为占位符的列，键为表名
+var sanitizedColumns = map[string][]string{
+	"BackupFilePhoneInfo":  {"snHash", "productDeviceId", "displayId"},
+	"BackupFileModuleInfo": {"appSignatures"},
+}
+
+// sanitizedContent 替换后的文件内容，.tar 文件中只有一个内容为它的条目
+const sanitizedContent = "sanitized by kobackup\n"
+
+// Sanitize 生成可以公开的备份副本，写入不存在的目录 outDir，用于复现格式相关的问题
+//
+// info.xml 保留原来的结构、版本和加密类型，只把 sanitizedColumns 中的列替换为占位符。
+// 除 info.xml 和 backupinfo.ini 外的文件都替换为很小的内容：.tar 是只有一个条目的 tar，
+// 其余文件是一行文本。原来加密的文件用 password 按原来的方式重新加密，每个模块使用新的
+// encMsgV3，每个 checkMsgV3 项使用新的 salt；不需要原来的密码，也不会读取原来的内容。
+//
+// checkMsgV3 中列出但不存在的文件不会生成，对应的项保留文件名，HMAC 替换为全零，
+// 避免泄露可以用来测试原密码的 HMAC。无效的项按原来的位置保留，HMAC 和 salt 部分同样替换为 0。
+//
+// backupinfo.ini 中的 apk_size、db_size 和 selectDataSize 按新文件更新，索引目录不会复制。
+// 失败时删除 outDir。progress 不为 nil 时在写入每个文件前以相对路径调用。
+func (b *Backup) Sanitize(outDir, password string, progress func(rel string)) error {
+	if password == "" {
+		return errors.New("password is empty")
+	}
+
+	err := checkOutside(b.Dir, outDir)
+	if err != nil {
+		return err
+	}
+
+	// 重新解析 info.xml，不修改 b.InfoXml
+	ix, err := infoxml.Parse(filepath.Join(b.Dir, "info.xml"))
+	if err != nil {
+		return fmt.Errorf("parse info.xml: %w", err)
+	}
+
+	var ini *backupinfo.Ini
+	info, err := backupinfo.Parse(filepath.Join(b.Dir, "backupinfo.ini"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil && info == nil:
+		return fmt.Errorf("parse backupinfo.ini: %w", err)
+	default:
+		ini = info.Ini
+	}
+
+	err = os.Mkdir(outDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = b.sanitize(ix, ini, outDir, password, progress)
+	if err != nil {
+		// outDir 是新创建的，失败时整个删除，不留下一半的备份
+		os.RemoveAll(outDir)
+		return err
+	}
+	return nil
+}
+
+func (b *Backup) sanitize(ix *infoxml.InfoXml, ini *backupinfo.Ini, outDir, password string, progress func(string)) error {
+	for i := range ix.Rows {
+		row := &ix.Rows[i]
+		for _, column := range sanitizedColumns[row.Table] {
+			if row.ColumnState(column) != infoxml.ValuePresent {
+				continue
+			}
+			// 不是 String 类型时替换为空字符串，同样不保留原来的值
+			value, _ := row.GetColumnString(column)
+			row.SetColumnValue(column, infoxml.StringValue(placeholder(value)))
+		}
+	}
+
+	// 已经写入的文件，替换其余文件时跳过
+	written := map[string]bool{}
+	for _, module := range b.Modules {
+		if module.EncMsgV3 == "" {
+			continue
+		}
+		encMsgV3, checkMsgV3, err := b.sanitizeModule(module, outDir, password, written, progress)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", module.Name, err)
+		}
+		if row := moduleRow(ix, module.Name); row != nil {
+			row.SetColumnValue("encMsgV3", infoxml.StringValue(encMsgV3))
+			if module.CheckMsgV3 != "" {
+				row.SetColumnValue("checkMsgV3", infoxml.StringValue(checkMsgV3))
+			}
+		}
+	}
+
+	err := filepath.WalkDir(b.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(b.Dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel == IndexDirName {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(outDir, rel), 0755)
+		}
+		if rel == "info.xml" || rel == "backupinfo.ini" || written[rel] || !d.Type().IsRegular() {
+			return nil
+		}
+		if progress != nil {
+			progress(rel)
+		}
+		content, err := sanitizedFile(b.moduleOf(rel), rel)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(outDir, rel), content, 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	if ini != nil {
+		total, err := updateAppSizes(ini, outDir)
+		if err != nil {
+			return err
+		}
+		// 文件都变小了，selectDataSize 与新的大小一致
+		if header := ix.GetFirstRowByTable("HeaderInfo"); header != nil && header.ColumnState("selectDataSize") == infoxml.ValuePresent {
+			header.SetColumnValue("selectDataSize", infoxml.LongValue(total))
+		}
+		err = ini.WriteFile(filepath.Join(outDir, "backupinfo.ini"))
+		if err != nil {
+			return err
+		}
+	}
+	return ix.WriteFile(filepath.Join(outDir, "info.xml"))
+}
+
+// sanitizeModule 用替换后的内容生成模块的加密分片，以及 checkMsgV3 中列出的备份根目录下的文件
+//
+//	r1 string 新的 encMsgV3
+//	r2 string 新的 checkMsgV3
+//	r3 error
+func (b *Backup) sanitizeModule(module infoxml.BackupFileModuleInfo, outDir, password string, written map[string]bool, progress func(string)) (string, string, error) {
+	encMsgV3, err := internal.NewEncMsgV3()
+	if err != nil {
+		return "", "", err
+	}
+	key := encMsgV3.DeriveKey(password)
+
+	// 无效的项按位置保留，HMAC 和 salt 替换为 0，便于复现格式问题
+	var oldItems []internal.CheckMsgV3Item
+	invalid := map[int]string{}
+	if module.CheckMsgV3 != "" {
+		var itemsErr *internal.CheckMsgV3Error
+		oldItems, err = internal.ParseCheckMsgV3Mode(module.CheckMsgV3, internal.CheckMsgV3Tolerant)
+		switch {
+		case errors.As(err, &itemsErr):
+			for _, itemErr := range itemsErr.Items {
+				invalid[itemErr.Index] = placeholderItem(itemErr.Item)
+			}
+		case err != nil:
+			// 整个 checkMsgV3 无效，逐项替换，分片按没有 checkMsgV3 项处理
+			for i, raw := range strings.Split(module.CheckMsgV3, "**") {
+				invalid[i] = placeholderItem(raw)
+			}
+		}
+	}
+
+	// 分片按文件名对应 checkMsgV3 项
+	files := map[string]string{}
+	chunks, err := b.ChunkFiles(module.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+	for _, chunk := range chunks {
+		files[filepath.Base(chunk)] = chunk
+	}
+
+	encrypt := func(path string, item *internal.CheckMsgV3Item) error {
+		rel, err := filepath.Rel(b.Dir, path)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(rel)
+		}
+		content, err := sanitizedFile(module.Name, rel)
+		if err != nil {
+			return err
+		}
+		var mac hash.Hash
+		if item != nil {
+			mac = item.NewHmac(password)
+		}
+		err = writeEncrypted(bytes.NewReader(content), filepath.Join(outDir, rel), key, encMsgV3.Iv, mac)
+		if err != nil {
+			return err
+		}
+		if item != nil {
+			item.ExpectedHmac = mac.Sum(nil)
+		}
+		written[rel] = true
+		return nil
+	}
+
+	items := make([]internal.CheckMsgV3Item, 0, len(oldItems))
+	for _, oldItem := range oldItems {
+		item, err := internal.NewCheckMsgV3Item(oldItem.FileName)
+		if err != nil {
+			return "", "", err
+		}
+
+		path, ok := files[oldItem.FileName]
+		if !ok {
+			path = filepath.Join(b.Dir, oldItem.FileName)
+			if _, err := os.Stat(path); err != nil {
+				// 保留缺少文件的项，HMAC 不能用原来的值
+				item.ExpectedHmac = make([]byte, len(oldItem.ExpectedHmac))
+				items = append(items, item)
+				continue
+			}
+		}
+		delete(files, oldItem.FileName)
+
+		err = encrypt(path, &item)
+		if err != nil {
+			return "", "", err
+		}
+		items = append(items, item)
+	}
+
+	// 没有 checkMsgV3 项的分片也用模块密钥加密
+	for _, chunk := range chunks {
+		if _, ok := files[filepath.Base(chunk)]; !ok {
+			continue
+		}
+		err := encrypt(chunk, nil)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// 按原来的顺序合并有效的项和无效的项
+	parts := make([]string, 0, len(items)+len(invalid))
+	next := 0
+	for i := 0; len(parts) < cap(parts); i++ {
+		if raw, ok := invalid[i]; ok {
+			parts = append(parts, raw)
+			continue
+		}
+		parts = append(parts, items[next].String())
+		next++
+	}
+	return encMsgV3.String(), strings.Join(parts, "**"), nil
+}
+
+// placeholderItem 把无效的 checkMsgV3 项前 128 个字符中的十六进制字符替换为 0，
+// 其中可能是可以用来测试密码的 HMAC；其余字符（包括文件名）保留
+func placeholderItem(raw string) string {
+	// 按字节替换，前缀的边界可能在多字节字符中间
+	b := []byte(raw)
+	for i := range min(len(b), 128) {
+		c := b[i]
+		if c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' {
+			b[i] = '0'
+		}
+	}
+	return string(b)
+}
+
+// moduleOf 返回路径所属的模块名，找不到时返回空字符串
+func (b *Backup) moduleOf(rel string) string {
+	first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	for _, module := range b.Modules {
+		if first == module.Name+"_appDataTar" || strings.HasPrefix(first, module.Name+".") {
+			return module.Name
+		}
+	}
+	return ""
+}
+
+// sanitizedFile 返回替换后的文件内容，.tar 文件是只有一个条目的 tar
+func sanitizedFile(module, rel string) ([]byte, error) {
+	if !strings.HasSuffix(rel, ".tar") {
+		return []byte(sanitizedContent), nil
+	}
+
+	name := "sanitized.txt"
+	if module != "" {
+		name = "data/data/" + module + "/" + name
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0600,
+		Size: int64(len(sanitizedContent)),
+		// 固定的时间，相同的输入生成相同的明文
+		ModTime: time.Unix(0, 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = tw.Write([]byte(sanitizedContent))
+	if err != nil {
+		return nil, err
+	}
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// placeholder 把字母和数字替换为 0，保留长度和分隔符，便于复现与格式有关的问题
+func placeholder(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return '0'
+		}
+		return r
+	}, s)
+}
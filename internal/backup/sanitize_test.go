@@ -0,0 +1,250 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/doctor"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// TestSanitize 检查替换后的备份保留结构和版本，只能用新密码解密，不包含原来的标识和内容
+func TestSanitize(t *testing.T) {
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{Password: "original"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 写入需要替换的标识
+	ix, err := infoxml.Parse(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone := ix.GetFirstRowByTable("BackupFilePhoneInfo")
+	phone.SetColumnValue("snHash", infoxml.StringValue("a1b2c3d4e5f6"))
+	phone.SetColumnValue("productDeviceId", infoxml.StringValue("SERIAL42"))
+	phone.SetColumnValue("displayId", infoxml.StringValue("HMA-AL00 10.1.0.163(C00E160R1P8)"))
+	for i := range ix.Rows {
+		if ix.Rows[i].Table == "BackupFileModuleInfo" {
+			ix.Rows[i].SetColumnValue("appSignatures", infoxml.StringValue("deadbeef"))
+		}
+	}
+	err = ix.WriteFile(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Open(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "sanitized")
+	err = b.Sanitize(out, "throwaway", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sanitized, err := backup.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phoneInfo, err := sanitized.InfoXml.GetBackupFilePhoneInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phoneInfo.SnHash != "000000000000" || phoneInfo.ProductDeviceId != "00000000" || phoneInfo.DisplayId != "000-0000 00.0.0.000(00000000000)" {
+		t.Errorf("phone info not sanitized: %q %q %q", phoneInfo.SnHash, phoneInfo.ProductDeviceId, phoneInfo.DisplayId)
+	}
+	if phoneInfo.ProductModel != "HMA-AL00" {
+		t.Errorf("productModel = %q, want it unchanged", phoneInfo.ProductModel)
+	}
+	header, err := sanitized.InfoXml.GetHeaderInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BackupVersion != 29 {
+		t.Errorf("backupVersion = %d, want 29", header.BackupVersion)
+	}
+	if len(sanitized.Modules) != len(b.Modules) {
+		t.Fatalf("got %d modules, want %d", len(sanitized.Modules), len(b.Modules))
+	}
+
+	for _, module := range sanitized.Modules {
+		if module.AppSignatures != "00000000" {
+			t.Errorf("%s: appSignatures = %q", module.Name, module.AppSignatures)
+		}
+		key, iv, err := backup.ModuleKey("throwaway", module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items, err := internal.ParseCheckMsgV3(module.CheckMsgV3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hmacs := map[string]internal.CheckMsgV3Item{}
+		for _, item := range items {
+			hmacs[item.FileName] = item
+		}
+
+		chunks, err := sanitized.ChunkFiles(module.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			item, ok := hmacs[filepath.Base(chunk)]
+			if !ok {
+				t.Fatalf("%s: no checkMsgV3 entry", chunk)
+			}
+			in, err := os.Open(chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var plain bytes.Buffer
+			result, err := utils.DecryptVerify(in, &plain, key, iv, utils.ALGO_AES_GCM, item.NewHmac("throwaway"))
+			in.Close()
+			if err != nil || result.TagErr != nil {
+				t.Fatalf("%s: DecryptVerify = %v, %v", chunk, err, result.TagErr)
+			}
+			if !item.Verify(result.Hmac) {
+				t.Errorf("%s: checkMsgV3 hash mismatch", chunk)
+			}
+
+			tr := tar.NewReader(&plain)
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatalf("%s: %v", chunk, err)
+			}
+			content, _ := io.ReadAll(tr)
+			if !strings.HasPrefix(hdr.Name, "data/data/"+module.Name+"/") || strings.Contains(string(content), "file") {
+				t.Errorf("%s: unexpected entry %s %q", chunk, hdr.Name, content)
+			}
+		}
+	}
+
+	// 原来的密码不能再解密
+	checker, err := sanitized.NewPasswordChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, _ := checker.Check(f.Password)
+	checker.Close()
+	if ok {
+		t.Errorf("the original password still matches")
+	}
+
+	apk, err := os.ReadFile(filepath.Join(out, "com.tencent.mm.apk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(apk, []byte("placeholder apk")) {
+		t.Errorf("apk not replaced: %q", apk)
+	}
+
+	info, err := backupinfo.Parse(filepath.Join(out, "backupinfo.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := doctor.Check(sanitized, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range findings {
+		t.Errorf("doctor: %s", finding)
+	}
+}
+
+// TestSanitizeInvalidCheckMsgV3 检查无效的 checkMsgV3 项按位置保留，HMAC 和 salt 替换为 0，
+// 整个 checkMsgV3 无效时也不会中止
+func TestSanitizeInvalidCheckMsgV3(t *testing.T) {
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hexPrefix := strings.Repeat("ab", 64)
+	badPath := hexPrefix + "_../evil.tar"
+	badHex := strings.Repeat("zz", 32) + strings.Repeat("cd", 32) + "_com.example.notes9.tar"
+	ix, err := infoxml.Parse(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ix.Rows {
+		row := &ix.Rows[i]
+		if row.Table != "BackupFileModuleInfo" {
+			continue
+		}
+		name, _ := row.GetColumnString("name")
+		if name == "com.example.notes" {
+			checkMsgV3, err := row.GetColumnString("checkMsgV3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			row.SetColumnValue("checkMsgV3", infoxml.StringValue(badPath+"**"+checkMsgV3+"**"+badHex))
+		}
+		// 整个 checkMsgV3 无效
+		if name == "com.android.chrome" {
+			row.SetColumnValue("checkMsgV3", infoxml.StringValue("abc_xyz"))
+		}
+	}
+	err = ix.WriteFile(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Open(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "sanitized")
+	err = b.Sanitize(out, "throwaway", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sanitized, err := backup.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := sanitized.Module("com.example.notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(module.CheckMsgV3, "**")
+	want := []string{strings.Repeat("0", 128) + "_../evil.tar", "", strings.Repeat("z", 64) + strings.Repeat("0", 64) + "_com.example.notes9.tar"}
+	if len(parts) != 3 || parts[0] != want[0] || parts[2] != want[2] {
+		t.Fatalf("checkMsgV3 = %q", module.CheckMsgV3)
+	}
+
+	chrome, err := sanitized.Module("com.android.chrome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chrome.CheckMsgV3 != "000_xyz" {
+		t.Errorf("invalid checkMsgV3 = %q, want %q", chrome.CheckMsgV3, "000_xyz")
+	}
+
+	// 有效的项用新密码重新生成
+	items, err := internal.ParseCheckMsgV3Mode(module.CheckMsgV3, internal.CheckMsgV3Tolerant)
+	if len(items) != 1 || items[0].FileName != "com.example.notes0.tar" {
+		t.Fatalf("valid items = %+v, err %v", items, err)
+	}
+	chunk := filepath.Join(out, "com.example.notes_appDataTar", "com.example.notes0.tar")
+	key, iv, err := backup.ModuleKey("throwaway", *module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := utils.DecryptVerifyFile(chunk, "", key, iv, utils.ALGO_AES_GCM, items[0].NewHmac("throwaway"))
+	if err != nil || result.TagErr != nil || !items[0].Verify(result.Hmac) {
+		t.Errorf("DecryptVerifyFile = %v, %v, hmac ok %v", err, result.TagErr, items[0].Verify(result.Hmac))
+	}
+}
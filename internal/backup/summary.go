@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// SummaryVersion Summary JSON 格式的版本，字段有不兼容的变化时递增
+const SummaryVersion = 1
+
+// Summary 备份内容的概要，JSON 字段名是稳定的，供脚本使用
+type Summary struct {
+	Version           int             `json:"version"`
+	Device            DeviceSummary   `json:"device"`
+	BackupVersion     int             `json:"backupVersion"`
+	BackupVersionName string          `json:"backupVersionName"`
+	DateTime          *time.Time      `json:"dateTime"` // 备份时间，没有时为 null
+	HisuiteVersion    string          `json:"hisuiteVersion"`
+	EncryptType       int             `json:"encryptType"`
+	SelectDataSize    int64           `json:"selectDataSize"`
+	Modules           []ModuleSummary `json:"modules"`
+}
+
+// DeviceSummary 设备信息，来自 BackupFilePhoneInfo
+type DeviceSummary struct {
+	Manufacturer   string `json:"manufacturer"`
+	Brand          string `json:"brand"`
+	Model          string `json:"model"`
+	DeviceId       string `json:"deviceId"`
+	DisplayId      string `json:"displayId"`
+	VersionRelease string `json:"versionRelease"`
+	VersionSdk     int    `json:"versionSdk"`
+}
+
+// ModuleSummary 模块信息，应用的名称、版本和大小来自 backupinfo.ini
+type ModuleSummary struct {
+	Name        string `json:"name"`
+	Type        int    `json:"type"`
+	InInfoXml   bool   `json:"inInfoXml"`   // 是否有 BackupFileModuleInfo 行
+	AppName     string `json:"appName"`     // 不是应用时为空
+	VersionName string `json:"versionName"` // 不是应用时为空
+	VersionCode int    `json:"versionCode"`
+	ApkSize     int64  `json:"apkSize"`
+	DbSize      int64  `json:"dbSize"`
+	Chunks      int    `json:"chunks"` // _appDataTar 下的分片数量
+}
+
+// Summary 汇总 info.xml 和 backupinfo.ini 中的信息
+//
+// info 为 nil 时只使用 info.xml；缺少的表对应的字段保持零值
+func (b *Backup) Summary(info *backupinfo.BackupInfo) (*Summary, error) {
+	ix := b.InfoXml
+	summary := &Summary{
+		Version: SummaryVersion,
+		Modules: []ModuleSummary{},
+	}
+
+	if len(ix.GetRowsByTable("HeaderInfo")) > 0 {
+		header, err := ix.GetHeaderInfo()
+		if err != nil {
+			return nil, err
+		}
+		summary.BackupVersion = header.BackupVersion
+		summary.SelectDataSize = header.SelectDataSize
+		if header.DateTime != 0 {
+			dateTime := time.UnixMilli(header.DateTime).UTC()
+			summary.DateTime = &dateTime
+		}
+	}
+
+	if len(ix.GetRowsByTable("BackupFilePhoneInfo")) > 0 {
+		phone, err := ix.GetBackupFilePhoneInfo()
+		if err != nil {
+			return nil, err
+		}
+		summary.Device = DeviceSummary{
+			Manufacturer:   phone.ProductManufacturer,
+			Brand:          phone.ProductBrand,
+			Model:          phone.ProductModel,
+			DeviceId:       phone.ProductDeviceId,
+			DisplayId:      phone.DisplayId,
+			VersionRelease: phone.VersionRelease,
+			VersionSdk:     phone.VersionSdk,
+		}
+	}
+
+	if len(ix.GetRowsByTable("BackupFileVersionInfo")) > 0 {
+		version, err := ix.GetBackupFileVersionInfo()
+		if err != nil {
+			return nil, err
+		}
+		summary.BackupVersionName = version.BackupVersionName
+	}
+
+	if len(ix.GetRowsByTable("BackupFilesTypeInfo")) > 0 {
+		typeInfo, err := ix.GetBackupFilesTypeInfo()
+		if err != nil {
+			return nil, err
+		}
+		summary.EncryptType = typeInfo.EncryptType
+	}
+
+	if info != nil {
+		summary.HisuiteVersion = info.HeaderInfo.HisuiteVersion
+	}
+
+	for _, module := range b.Modules {
+		summary.Modules = append(summary.Modules, b.moduleSummary(module.Name, &module, info))
+	}
+	// 只在 backupinfo.ini 中出现的应用
+	if info != nil {
+		for _, app := range info.Apps {
+			if _, err := b.Module(app.PackageName); err == nil {
+				continue
+			}
+			summary.Modules = append(summary.Modules, b.moduleSummary(app.PackageName, nil, info))
+		}
+	}
+
+	return summary, nil
+}
+
+func (b *Backup) moduleSummary(name string, module *infoxml.BackupFileModuleInfo, info *backupinfo.BackupInfo) ModuleSummary {
+	m := ModuleSummary{Name: name}
+	if module != nil {
+		m.Type = module.Type
+		m.InInfoXml = true
+	}
+
+	if info != nil {
+		if app := info.App(name); app != nil {
+			m.AppName = app.AppName
+			m.VersionName = app.VersionName
+			m.VersionCode = app.VersionCode
+			m.ApkSize = app.ApkSize
+			m.DbSize = app.DbSize
+		}
+	}
+
+	// 没有 _appDataTar 目录时分片数为 0
+	chunks, _ := b.ChunkFiles(name)
+	m.Chunks = len(chunks)
+	return m
+}
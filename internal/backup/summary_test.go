@@ -0,0 +1,68 @@
+package backup_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// TestSummaryJSON 检查 Summary 的 JSON 格式，字段名变化会破坏使用它的脚本
+func TestSummaryJSON(t *testing.T) {
+	dir := t.TempDir()
+
+	infoXml := &infoxml.InfoXml{}
+	header := infoXml.AddRow("HeaderInfo")
+	header.SetColumnValue("backupVersion", infoxml.IntegerValue(29))
+	header.SetColumnValue("dateTime", infoxml.LongValue(1728491629000))
+	infoXml.AddRow("BackupFilePhoneInfo").SetColumnValue("productModel", infoxml.StringValue("HMA-AL00"))
+	infoXml.AddRow("BackupFilesTypeInfo").SetColumnValue("encrypt_type", infoxml.IntegerValue(1))
+	module := infoXml.AddRow("BackupFileModuleInfo")
+	module.SetColumnValue("name", infoxml.StringValue("com.tencent.mm"))
+	module.SetColumnValue("type", infoxml.IntegerValue(3))
+	err := infoXml.WriteFile(filepath.Join(dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "com.tencent.mm_appDataTar"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "com.tencent.mm_appDataTar", "com.tencent.mm0.tar"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupInfo, err := backupinfo.ParseString("[headerinfo]\r\nhisuiteversion=14.0.0.320\r\n" +
+		"[overview]\r\napp_info=com.tencent.mm,com.example\r\n" +
+		"[com.tencent.mm]\r\napp_name=WeChat\r\nversion_name=8.0.50\r\nversion_code=2800\r\napk_size=10\r\ndb_size=20\r\n" +
+		"[com.example]\r\napp_name=Example\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := b.Summary(backupInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"version":1,"device":{"manufacturer":"","brand":"","model":"HMA-AL00","deviceId":"","displayId":"","versionRelease":"","versionSdk":0},` +
+		`"backupVersion":29,"backupVersionName":"","dateTime":"2024-10-09T16:33:49Z","hisuiteVersion":"14.0.0.320","encryptType":1,"selectDataSize":0,` +
+		`"modules":[{"name":"com.tencent.mm","type":3,"inInfoXml":true,"appName":"WeChat","versionName":"8.0.50","versionCode":2800,"apkSize":10,"dbSize":20,"chunks":1},` +
+		`{"name":"com.example","type":0,"inInfoXml":false,"appName":"Example","versionName":"","versionCode":0,"apkSize":0,"dbSize":0,"chunks":0}]}`
+	if string(out) != want {
+		t.Errorf("Summary JSON =\n%s\nwant\n%s", out, want)
+	}
+}
@@ -0,0 +1,161 @@
+package backupinfo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
+)
+
+// BackupInfo 存储从 backupinfo.ini 解析出的信息
+type BackupInfo struct {
+	Ini          *Ini       // 完整的 INI 内容，修改后可以写回
+	HeaderInfo   HeaderInfo // [headerinfo]
+	Overview     Overview   // [overview]
+	PackageNames []string   // 包名列表，来自 app_info
+	Apps         []AppInfo  // 应用信息列表，每个应用一个节
+}
+
+// HeaderInfo 表示 [headerinfo] 节
+type HeaderInfo struct {
+	HisuiteVersion string `ini:"hisuiteversion"` // HiSuite 版本
+
+	Extra map[string]string // 其他键
+}
+
+// Overview 表示 [overview] 节
+type Overview struct {
+	AppInfo string `ini:"app_info"` // 包名列表，逗号分隔
+
+	Extra map[string]string // 其他键
+}
+
+// AppInfo 存储单个应用的信息，节名为包名
+type AppInfo struct {
+	PackageName string
+	AppName     string `ini:"app_name"`
+	VersionCode int    `ini:"version_code"`
+	VersionName string `ini:"version_name"`
+	IsHaveDb    int    `ini:"is_have_db"`
+	IsHapApp    int    `ini:"is_hap_app"`
+	ApkSize     int64  `ini:"apk_size"`
+	DbSize      int64  `ini:"db_size"`
+
+	Extra map[string]string // 其他键
+}
+
+// Parse 从 backupinfo.ini 文件中解析
+func Parse(iniPath string) (*BackupInfo, error) {
+	// 流式解码，只限制解码后的大小，与 ParseIni 一致
+	content, _, _, err := textenc.ReadFileDecoded(iniPath, MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return ParseString(string(content))
+}
+
+// ParseString 从已解码的 backupinfo.ini 内容中解析
+//
+// 语法错误和类型错误都会返回错误，此时仍然返回其余内容的解析结果；没有包名时返回空列表
+func ParseString(content string) (*BackupInfo, error) {
+	ini, err := ParseIni(content)
+	if ini == nil {
+		return nil, err
+	}
+
+	backupInfo := &BackupInfo{Ini: ini}
+	errs := []error{err}
+
+	if section := ini.Section("headerinfo"); section != nil {
+		errs = append(errs, decodeSection(section, &backupInfo.HeaderInfo)...)
+	}
+	if section := ini.Section("overview"); section != nil {
+		errs = append(errs, decodeSection(section, &backupInfo.Overview)...)
+	}
+
+	// app_info 通常在 [overview] 中，兼容出现在其他节的情况
+	appInfo, ok := "", false
+	for _, section := range ini.Sections {
+		appInfo, ok = section.Get("app_info")
+		if ok {
+			break
+		}
+	}
+	for _, part := range strings.Split(appInfo, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			backupInfo.PackageNames = append(backupInfo.PackageNames, part)
+		}
+	}
+
+	for _, section := range ini.Sections {
+		if section.Name == "" || section.Name == "headerinfo" || section.Name == "overview" {
+			continue
+		}
+		app := AppInfo{PackageName: section.Name}
+		errs = append(errs, decodeSection(section, &app)...)
+		backupInfo.Apps = append(backupInfo.Apps, app)
+	}
+
+	return backupInfo, errors.Join(errs...)
+}
+
+// App 根据包名查找应用信息
+func (b *BackupInfo) App(packageName string) *AppInfo {
+	for i := range b.Apps {
+		if b.Apps[i].PackageName == packageName {
+			return &b.Apps[i]
+		}
+	}
+	return nil
+}
+
+// decodeSection 根据 `ini:"key"` tag 把节解码到结构体，没有 tag 的键放入 Extra
+func decodeSection(section *Section, v any) []error {
+	var errs []error
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	known := map[string]bool{}
+	for i := 0; i < rt.NumField(); i++ {
+		key, ok := rt.Field(i).Tag.Lookup("ini")
+		if !ok {
+			continue
+		}
+		known[key] = true
+
+		value, ok := section.Get(key)
+		if !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("[%s] %s: %w", section.Name, key, err))
+				continue
+			}
+			field.SetInt(n)
+		}
+	}
+
+	extra := rv.FieldByName("Extra")
+	for _, kv := range section.Keys {
+		if kv.Key == "" || known[kv.Key] || !extra.IsValid() {
+			continue
+		}
+		if extra.IsNil() {
+			extra.Set(reflect.ValueOf(map[string]string{}))
+		}
+		extra.SetMapIndex(reflect.ValueOf(kv.Key), reflect.ValueOf(kv.Value))
+	}
+
+	return errs
+}
@@ -0,0 +1,114 @@
+package backupinfo_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+)
+
+const sampleIni = "[headerinfo]\r\nhisuiteversion=14.0.0.320\r\nnewkey=1\r\n" +
+	"[overview]\r\napp_info=com.tencent.mm,com.example,\r\n" +
+	"[com.tencent.mm]\r\napp_name=WeChat\r\nversion_code=2800\r\napk_size=123456789012\r\n" +
+	"[com.example]\r\napp_name=Example\r\n"
+
+// TestParseAndWrite 检查所有节都被解析，并能以 UTF-16LE 写回
+func TestParseAndWrite(t *testing.T) {
+	backupInfo, err := backupinfo.ParseString(sampleIni)
+	if err != nil {
+		t.Fatalf("ParseString: %v", err)
+	}
+
+	if backupInfo.HeaderInfo.HisuiteVersion != "14.0.0.320" || backupInfo.HeaderInfo.Extra["newkey"] != "1" {
+		t.Errorf("HeaderInfo = %+v", backupInfo.HeaderInfo)
+	}
+	if len(backupInfo.PackageNames) != 2 || backupInfo.PackageNames[1] != "com.example" {
+		t.Errorf("PackageNames = %v", backupInfo.PackageNames)
+	}
+	app := backupInfo.App("com.tencent.mm")
+	if app == nil || app.AppName != "WeChat" || app.VersionCode != 2800 || app.ApkSize != 123456789012 {
+		t.Errorf("App = %+v", app)
+	}
+
+	iniPath := filepath.Join(t.TempDir(), "backupinfo.ini")
+	err = backupInfo.Ini.WriteFile(iniPath)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	reparsed, err := backupinfo.Parse(iniPath)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if reparsed.Ini.String() != sampleIni {
+		t.Errorf("round trip mismatch:\n%q", reparsed.Ini.String())
+	}
+}
+
+// TestParseErrors 检查语法错误和类型错误被报告
+func TestParseErrors(t *testing.T) {
+	for _, content := range []string{
+		"[headerinfo\nkey=value\n",
+		"[overview]\nnot a key value\n",
+		"[com.example]\nversion_code=abc\n",
+	} {
+		_, err := backupinfo.ParseString(content)
+		if err == nil {
+			t.Errorf("ParseString(%q) should fail", content)
+		}
+	}
+}
+
+// TestParsePartial 检查无法解析的行被报告并原样保留，其余内容照常解析
+func TestParsePartial(t *testing.T) {
+	content := "[overview]\nnot a key value\napp_info=com.a\n[com.a\n=1\n[com.a]\nversion_code=3\n"
+	backupInfo, err := backupinfo.ParseString(content)
+	if err == nil {
+		t.Fatal("ParseString should report the malformed lines")
+	}
+	for _, want := range []string{"line 2", "line 4", "line 5"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if backupInfo == nil {
+		t.Fatal("ParseString returned no result")
+	}
+	if len(backupInfo.PackageNames) != 1 || backupInfo.PackageNames[0] != "com.a" {
+		t.Errorf("PackageNames = %v", backupInfo.PackageNames)
+	}
+	if app := backupInfo.App("com.a"); app == nil || app.VersionCode != 3 {
+		t.Errorf("App(com.a) = %+v", app)
+	}
+	if out := backupInfo.Ini.String(); out != content {
+		t.Errorf("String() = %q, want %q", out, content)
+	}
+}
+
+// FuzzParseString 检查任意内容都不会 panic，解析成功的内容写回后能解析出相同的节和键
+func FuzzParseString(f *testing.F) {
+	f.Add(sampleIni)
+	f.Add("[headerinfo]\nhisuiteversion=14.0.0.320\n; comment\n# comment\n")
+	f.Add("key=value\n[overview]\napp_info=,,a,\n[a]\nversion_code=1\n")
+	f.Add("\uFEFF[overview]\r\napp_info=com.a\r\n[com.a]\r\napk_size=99999999999999999999\r\n")
+	f.Add("[]\n=\n")
+	f.Add("[")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, content string) {
+		backupInfo, _ := backupinfo.ParseString(content)
+		if backupInfo == nil {
+			return
+		}
+		out := backupInfo.Ini.String()
+		_, syntaxErr := backupinfo.ParseIni(content)
+		reparsed, err := backupinfo.ParseIni(out)
+		// 无法解析的行原样写回，只有原文没有语法错误时写回的内容才没有
+		if reparsed == nil || (err == nil) != (syntaxErr == nil) {
+			t.Fatalf("ParseIni(%q): %v, original: %v", out, err, syntaxErr)
+		}
+		if reparsed.String() != out {
+			t.Fatalf("round trip mismatch:\n%q\n%q", reparsed.String(), out)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package backupinfo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
+)
+
+// Ini 是保留节顺序和所有键的 INI 模型
+type Ini struct {
+	Sections []*Section // 按出现顺序排列，第一个节可能是名字为空的全局节
+	Newline  string     // 换行符，解析时从文件中推断
+}
+
+// Section 表示 INI 中的一个节
+type Section struct {
+	Name string
+	Keys []KeyValue // 按出现顺序排列
+}
+
+// KeyValue 表示一个键值对，Key 为空时 Value 是一行注释
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// MaxSize 解码后的 backupinfo.ini 的最大大小，每个应用只有几行
+const MaxSize = 4 << 20
+
+// ParseIni 解析 INI 文本
+//
+// 空行会被丢弃，注释行（; 或 # 开头）会保留；content 不能超过 MaxSize。
+// 无法解析的行（缺少 '='、键为空、节头不完整）原样保留在所在的节中，写回时不变，
+// 每行的问题合并到返回的错误中，此时 Ini 仍然包含其余的内容
+func ParseIni(content string) (*Ini, error) {
+	if len(content) > MaxSize {
+		return nil, fmt.Errorf("backupinfo.ini is larger than %d bytes: %w", MaxSize, textenc.ErrTooLarge)
+	}
+	ini := &Ini{Newline: "\n"}
+	if strings.Contains(content, "\r\n") {
+		ini.Newline = "\r\n"
+	}
+
+	var current *Section
+	var errs []error
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = &Section{Name: strings.TrimSpace(line[1 : len(line)-1])}
+			ini.Sections = append(ini.Sections, current)
+			continue
+		}
+
+		if current == nil {
+			// 第一个节之前的内容属于全局节
+			current = &Section{}
+			ini.Sections = append(ini.Sections, current)
+		}
+
+		err := checkLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+		}
+		if err != nil || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			// 与注释一样只保留原文
+			current.Keys = append(current.Keys, KeyValue{Value: line})
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		current.Keys = append(current.Keys, KeyValue{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+	}
+
+	return ini, errors.Join(errs...)
+}
+
+// checkLine 检查不是节头的非空行，注释行总是有效
+func checkLine(line string) error {
+	switch {
+	case strings.HasPrefix(line, ";"), strings.HasPrefix(line, "#"):
+		return nil
+	case strings.HasPrefix(line, "["):
+		return fmt.Errorf("malformed section header: %q", line)
+	}
+	key, _, ok := strings.Cut(line, "=")
+	if !ok {
+		return fmt.Errorf("missing '=': %q", line)
+	}
+	if strings.TrimSpace(key) == "" {
+		return errors.New("empty key")
+	}
+	return nil
+}
+
+// Section 根据名字获取节，不存在时返回 nil
+func (ini *Ini) Section(name string) *Section {
+	for _, section := range ini.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// AddSection 在末尾追加一个节并返回它
+func (ini *Ini) AddSection(name string) *Section {
+	section := &Section{Name: name}
+	ini.Sections = append(ini.Sections, section)
+	return section
+}
+
+// Get 获取键的值
+func (s *Section) Get(key string) (string, bool) {
+	for _, kv := range s.Keys {
+		if kv.Key == key && key != "" {
+			return kv.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set 设置键的值，键不存在时追加到节末
+func (s *Section) Set(key string, value string) {
+	for i := range s.Keys {
+		if s.Keys[i].Key == key {
+			s.Keys[i].Value = value
+			return
+		}
+	}
+	s.Keys = append(s.Keys, KeyValue{Key: key, Value: value})
+}
+
+// String 生成 INI 文本
+func (ini *Ini) String() string {
+	newline := ini.Newline
+	if newline == "" {
+		newline = "\n"
+	}
+
+	var b strings.Builder
+	for _, section := range ini.Sections {
+		if section.Name != "" {
+			b.WriteString("[" + section.Name + "]" + newline)
+		}
+		for _, kv := range section.Keys {
+			if kv.Key == "" {
+				b.WriteString(kv.Value + newline)
+				continue
+			}
+			b.WriteString(kv.Key + "=" + kv.Value + newline)
+		}
+	}
+	return b.String()
+}
+
+// MarshalUTF16LE 生成带 BOM 的 UTF-16LE 编码内容，与 HiSuite 生成的文件一致
+func (ini *Ini) MarshalUTF16LE() []byte {
+	units := utf16.Encode([]rune(ini.String()))
+	content := make([]byte, 2, 2+len(units)*2)
+	content[0], content[1] = 0xFF, 0xFE
+	for _, u := range units {
+		content = append(content, byte(u), byte(u>>8))
+	}
+	return content
+}
+
+// WriteFile 以带 BOM 的 UTF-16LE 写入文件
+func (ini *Ini) WriteFile(iniPath string) error {
+	return os.WriteFile(iniPath, ini.MarshalUTF16LE(), 0644)
+}
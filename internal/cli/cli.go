@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/logging"
+)
+
+// Command 表示 kobackup 的一个子命令
+type Command struct {
+	Name  string
+	Short string // 一行说明
+
+	// Setup 在 fs 中注册子命令自己的参数，返回解析参数后执行的函数
+	Setup func(fs *flag.FlagSet) func(g *Globals) error
+}
+
+// commands 所有子命令，按帮助中显示的顺序排列
+var commands = []*Command{
+	infoCommand,
+	lsCommand,
+	extractCommand,
+	indexCommand,
+	verifyCommand,
+	decryptCommand,
+	decryptDirCommand,
+	exportKeysCommand,
+	tryPasswordsCommand,
+	repasswordCommand,
+	packCommand,
+	sanitizeCommand,
+	validateCommand,
+	doctorCommand,
+	fixtureCommand,
+}
+
+func lookup(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// Globals 所有子命令共享的全局参数，可以写在子命令之前或之后
+type Globals struct {
+	Password        string // 备份密码
+	PasswordFile    string // 保存密码的文件
+	PasswordFd      int    // 读取密码的文件描述符，-1 表示不使用
+	PasswordCommand string // 标准输出为密码的命令
+	Format          string // 输出格式：text 或 json
+	LogLevel        string // 日志级别：debug、info、warn、error
+	LogFormat       string // 日志格式：text 或 json
+	Quiet           bool   // 只输出错误日志，等同于 --log-level error
+	DebugSecrets    bool   // 在日志中输出 salt、IV、设备标识
+
+	password *string // 已读取的密码
+}
+
+// register 在 fs 中注册全局参数，默认值为当前的值
+func (g *Globals) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.Password, "password", g.Password, "Backup password used to derive the keys (visible in ps and shell history)")
+	fs.StringVar(&g.PasswordFile, "password-file", g.PasswordFile, "Read the password from this file")
+	fs.IntVar(&g.PasswordFd, "password-fd", g.PasswordFd, "Read the password from this file descriptor")
+	fs.StringVar(&g.PasswordCommand, "password-command", g.PasswordCommand, "Run this shell command and use its stdout as the password")
+	fs.StringVar(&g.Format, "format", g.Format, "Output format: text or json")
+	fs.BoolFunc("json", "Shorthand for --format json", func(s string) error {
+		if s == "true" {
+			g.Format = "json"
+		}
+		return nil
+	})
+	fs.StringVar(&g.LogLevel, "log-level", g.LogLevel, "Log level: debug, info, warn or error")
+	fs.StringVar(&g.LogFormat, "log-format", g.LogFormat, "Log format: text or json")
+	fs.BoolVar(&g.Quiet, "quiet", g.Quiet, "Only log errors, same as --log-level error")
+	fs.BoolVar(&g.DebugSecrets, "debug-secrets", g.DebugSecrets, "Log salts, IVs and device identifiers instead of redacting them (derived keys are never logged)")
+}
+
+// check 检查全局参数，并把日志输出设置为 slog
+func (g *Globals) check() error {
+	switch g.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown format %q, expected text or json", g.Format)
+	}
+
+	level, err := logging.ParseLevel(g.LogLevel)
+	if err != nil {
+		return fmt.Errorf("unknown log level %q, expected debug, info, warn or error", g.LogLevel)
+	}
+	if g.Quiet {
+		level = slog.LevelError
+	}
+	logger, err := logging.New(os.Stderr, logging.Options{
+		Level:        level,
+		Format:       g.LogFormat,
+		DebugSecrets: g.DebugSecrets,
+	})
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// JSON 判断是否以 JSON 输出
+func (g *Globals) JSON() bool {
+	return g.Format == "json"
+}
+
+// errFailed 表示部分操作失败，具体原因已经输出到日志
+var errFailed = errors.New("one or more operations failed")
+
+// errUsage 表示参数错误，用法已经输出
+var errUsage = errors.New("usage error")
+
+// Main 运行 kobackup，args 不包含程序名，返回退出码
+func Main(args []string) int {
+	g := &Globals{PasswordFd: -1, Format: "text", LogLevel: "info", LogFormat: "text"}
+
+	fs := flag.NewFlagSet("kobackup", flag.ContinueOnError)
+	g.register(fs)
+	fs.Usage = func() { usage(fs) }
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		usage(fs)
+		return 2
+	}
+	if args[0] == "help" {
+		if len(args) > 1 && lookup(args[1]) != nil {
+			return run(g, lookup(args[1]), []string{"-h"})
+		}
+		usage(fs)
+		return 0
+	}
+
+	cmd := lookup(args[0])
+	if cmd == nil {
+		fmt.Fprintf(fs.Output(), "kobackup: unknown command %q\n\n", args[0])
+		usage(fs)
+		return 2
+	}
+	return run(g, cmd, args[1:])
+}
+
+// run 解析子命令参数并执行
+func run(g *Globals, cmd *Command, args []string) int {
+	fs := flag.NewFlagSet("kobackup "+cmd.Name, flag.ContinueOnError)
+	runFunc := cmd.Setup(fs)
+	g.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kobackup %s [flags]\n\n%s\n\nFlags:\n", cmd.Name, cmd.Short)
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	err = g.check()
+	if err != nil {
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		return 2
+	}
+
+	err = runFunc(g)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		return 2
+	case errors.Is(err, errFailed):
+		return 1
+	default:
+		slog.Error(err.Error())
+		return 1
+	}
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: kobackup [global flags] <command> [flags]\n\nCommands:\n")
+	tw := newTable(out)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.Name, cmd.Short)
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\nGlobal flags:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(out, "\nRun 'kobackup help <command>' for the flags of a command.\n")
+}
+
+// usageErrorf 输出参数错误并返回 errUsage
+func usageErrorf(format string, args ...any) error {
+	slog.Error(fmt.Sprintf(format, args...))
+	return errUsage
+}
+
+// newTable 返回对齐输出列的 tabwriter
+func newTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
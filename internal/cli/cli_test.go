@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMainExitCode 检查全局参数可以写在子命令前后，以及参数错误时的退出码
+func TestMainExitCode(t *testing.T) {
+	dir := t.TempDir()
+	infoXml := "<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>\n<info.xml>\n" +
+		"<row table=\"BackupFileModuleInfo\">\n<column name=\"name\">\n<value String=\"contact\" />\n</column>\n</row>\n" +
+		"</info.xml>\n"
+	err := os.WriteFile(filepath.Join(dir, "info.xml"), []byte(infoXml), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"--quiet", "--json", "info", "--input", dir}, 0},
+		{[]string{"info", "--input", dir, "--format", "json", "--quiet"}, 0},
+		{[]string{"info", "--input", dir, "--format", "xml"}, 2},
+		{[]string{"info", "--input", dir, "extra"}, 2},
+		{[]string{"info", "--input", filepath.Join(dir, "missing")}, 1},
+		{[]string{"ls", "--input", dir}, 1}, // 没有密码
+		{[]string{"unknown"}, 2},
+		{[]string{}, 2},
+	}
+	for _, tt := range tests {
+		got := Main(tt.args)
+		if got != tt.want {
+			t.Errorf("Main(%q) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+var decryptCommand = &Command{
+	Name:  "decrypt",
+	Short: "Decrypt a single encrypted file",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argEncMsgV3 := fs.String("encMsgV3", "", "EncMsgV3 string containing salt and IV information")
+		argInput := fs.String("input", "", "Input file path")
+		argOutput := fs.String("output", "", "Output file path")
+		argCheckMsgV3 := fs.String("checkMsgV3", "", "Optional CheckMsgV3 string, verify the input HMAC while decrypting")
+		keys := &keyFlags{}
+		keys.register(fs)
+		return func(g *Globals) error {
+			if *argInput == "" || *argOutput == "" {
+				return usageErrorf("--input and --output are required")
+			}
+			err := keys.check()
+			if err != nil {
+				return err
+			}
+			if keys.KeyHex != "" && *argCheckMsgV3 != "" {
+				return usageErrorf("--checkMsgV3 needs the password or --keyfile, --key-hex has no HMAC key")
+			}
+			return runDecrypt(g, keys, *argEncMsgV3, *argInput, *argOutput, *argCheckMsgV3)
+		}
+	},
+}
+
+func runDecrypt(g *Globals, keys *keyFlags, encMsgV3 string, input string, output string, checkMsgV3 string) error {
+	crypto, err := keys.fileCrypto(g, encMsgV3)
+	if err != nil {
+		return err
+	}
+
+	if checkMsgV3 == "" {
+		// 解密文件
+		err = utils.DecryptFile(input, output, crypto.key, crypto.iv, utils.ALGO_AES_GCM)
+		if err != nil {
+			return fmt.Errorf("DecryptFile Failed: %w", err)
+		}
+
+		slog.Info("decrypted", "file", input, "output", output)
+		return nil
+	}
+
+	checkMsgV3Item, err := findCheckMsgV3Item(checkMsgV3, input)
+	if err != nil {
+		return err
+	}
+
+	mac := crypto.newHmac(*checkMsgV3Item)
+	if mac == nil {
+		return fmt.Errorf("no HMAC key for %s in keyfile", checkMsgV3Item.FileName)
+	}
+
+	// 解密文件，同时校验 checkMsgV3 HMAC 和 GCM tag，只读取一次密文
+	result, err := utils.DecryptVerifyFile(input, output, crypto.key, crypto.iv, utils.ALGO_AES_GCM, mac)
+	if err != nil {
+		return fmt.Errorf("DecryptFile Failed: %w", err)
+	}
+
+	hmacOk := checkMsgV3Item.Verify(result.Hmac)
+	if hmacOk {
+		slog.Info("checkMsgV3 OK", "file", input)
+	} else {
+		slog.Error("checkMsgV3 hash mismatch", "file", input, "hmac", fmt.Sprintf("%X", result.Hmac))
+	}
+	if result.TagErr != nil {
+		return fmt.Errorf("GCM tag verification failed: %w", result.TagErr)
+	}
+	slog.Info("GCM tag OK", "file", input)
+
+	if !hmacOk {
+		return errFailed
+	}
+	slog.Info("decrypted", "file", input, "output", output)
+	return nil
+}
@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+var decryptDirCommand = &Command{
+	Name:  "decrypt-dir",
+	Short: "Decrypt every module of a backup directory into <input>_decrypted, or only verify it",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input directory path")
+		argPasswordList := fs.String("password-list", "", "File with known passwords, one per line; the one matching the backup is used")
+		argVerifyOnly := fs.Bool("verify-only", false, "Decrypt without writing plaintext, check GCM tags, checkMsgV3 HMACs and tar structure, and report failing files")
+		keys := &keyFlags{}
+		keys.register(fs)
+		return func(g *Globals) error {
+			err := keys.check()
+			if err != nil {
+				return err
+			}
+			if *argPasswordList != "" {
+				if keys.KeyHex != "" || keys.KeyFile != "" {
+					return usageErrorf("--password-list cannot be used with --key-hex or --keyfile")
+				}
+				if g.passwordGiven() {
+					return usageErrorf("--password-list cannot be used with another password source")
+				}
+			}
+			return runDecryptDir(g, keys, *argInput, *argPasswordList, *argVerifyOnly)
+		}
+	},
+}
+
+// chunkResult decrypt-dir --verify-only 中一个分片的校验结果
+type chunkResult struct {
+	File    string   `json:"file"` // 相对于备份目录的路径（使用 /）
+	Module  string   `json:"module"`
+	Entries int      `json:"entries"`          // tar 中的条目数
+	Errors  []string `json:"errors,omitempty"` // 实际解密时会失败的原因
+}
+
+func runDecryptDir(g *Globals, keys *keyFlags, inputPath string, passwordList string, verifyOnly bool) error {
+	b, err := backup.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+
+	// 从已知的密码中找出这个备份的密码
+	if passwordList != "" {
+		candidates, err := readCandidates(passwordList)
+		if err != nil {
+			return err
+		}
+		password, found, _, err := findPassword(b, candidates, 0)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("none of the passwords in %s matches the backup", passwordList)
+		}
+		g.password = &password
+	}
+
+	// keyfile 无法读取时不必创建输出目录
+	if keys.KeyFile != "" {
+		_, err = keys.loadKeyFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	// 只校验时不创建输出目录
+	outputDir := ""
+	if !verifyOnly {
+		// 计算输出目录路径：在原目录名后添加 "_decrypted"
+		outputDir = filepath.Clean(inputPath) + "_decrypted"
+
+		// 创建输出目录
+		err = os.MkdirAll(outputDir, 0755)
+		if err != nil {
+			return fmt.Errorf("Failed to create output directory: %w", err)
+		}
+	}
+
+	if keys.KeyHex != "" {
+		slog.Warn("--key-hex is used for every module, checkMsgV3 HMAC will not be checked")
+	}
+
+	// 解密APP目录，分片失败时继续处理其他分片
+	results := []chunkResult{}
+	for _, fileModuleInfo := range b.Modules {
+		err := decryptFileModule(g, keys, b, outputDir, fileModuleInfo, verifyOnly, &results)
+		if err != nil {
+			slog.Error("failed to decrypt module", "module", fileModuleInfo.Name, "err", err)
+			results = append(results, chunkResult{
+				File:   fileModuleInfo.Name + "_appDataTar",
+				Module: fileModuleInfo.Name,
+				Errors: []string{err.Error()},
+			})
+		}
+	}
+
+	if verifyOnly {
+		return reportVerifyOnly(g, results)
+	}
+
+	failed := countFailed(results)
+	slog.Info("folder decryption completed", "output", outputDir, "failed", failed)
+	if failed > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// countFailed 返回有错误的分片数
+func countFailed(results []chunkResult) int {
+	failed := 0
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			failed++
+		}
+	}
+	return failed
+}
+
+// reportVerifyOnly 输出 --verify-only 的结果，有文件校验失败时返回 errFailed
+func reportVerifyOnly(g *Globals, results []chunkResult) error {
+	failed := countFailed(results)
+
+	if g.JSON() {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(results)
+		if err != nil {
+			return fmt.Errorf("Failed to encode results: %w", err)
+		}
+	} else {
+		for _, result := range results {
+			if len(result.Errors) > 0 {
+				fmt.Printf("FAIL %s: %s\n", result.File, strings.Join(result.Errors, "; "))
+			}
+		}
+	}
+
+	slog.Info("folder verification completed", "files", len(results), "failed", failed)
+	if failed > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// verifyChunk 解密分片但不保存明文，同时校验 GCM tag、checkMsgV3 HMAC 和明文的 tar 结构
+//
+//	r1 utils.VerifyResult
+//	r2 int tar 中的条目数
+//	r3 error tar 结构错误
+//	r4 error 读取或解密错误
+func verifyChunk(path string, crypto *moduleCrypto, mac hash.Hash) (utils.VerifyResult, int, error, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return utils.VerifyResult{}, 0, nil, err
+	}
+	defer in.Close()
+
+	// 明文写入 Validator，生成 CTR 密钥流解密的同时计算 GCM tag
+	validator := archive.NewValidator()
+	result, err := utils.DecryptVerify(in, validator, crypto.key, crypto.iv, utils.ALGO_AES_GCM, mac)
+	entries, tarErr := validator.Close()
+	return result, entries, tarErr, err
+}
+
+// decryptFileModule 解密模块的所有分片到 outputDir，verifyOnly 时只校验；每个分片的结果追加到 results
+func decryptFileModule(g *Globals, keys *keyFlags, b *backup.Backup, outputDir string, fileModuleInfo infoxml.BackupFileModuleInfo, verifyOnly bool, results *[]chunkResult) error {
+	inputPath := b.Dir
+	crypto, err := keys.moduleCrypto(g, b, fileModuleInfo)
+	if err != nil {
+		return err
+	}
+
+	// checkMsgV3 中每个分片的 HMAC，解密时一并校验
+	checkMsgV3Items := map[string]internal.CheckMsgV3Item{}
+	items, err := internal.ParseCheckMsgV3Mode(fileModuleInfo.CheckMsgV3, internal.CheckMsgV3Tolerant)
+	var itemsErr *internal.CheckMsgV3Error
+	switch {
+	case errors.As(err, &itemsErr):
+		// 其余项仍然校验
+		for _, itemErr := range itemsErr.Items {
+			slog.Warn("invalid checkMsgV3 item, its file will not be checked", "module", fileModuleInfo.Name, "item", itemErr.Index, "err", itemErr.Err)
+		}
+	case err != nil:
+		slog.Warn("invalid checkMsgV3, HMAC will not be checked", "module", fileModuleInfo.Name, "err", err)
+	}
+	for _, item := range items {
+		checkMsgV3Items[item.FileName] = item
+	}
+
+	// 使用 filepath.WalkDir 遍历所有目标目录
+	targetTarDir := filepath.Join(inputPath, fileModuleInfo.Name+"_appDataTar")
+	slog.Debug("walking directory", "dir", targetTarDir)
+	report := func(result chunkResult) {
+		*results = append(*results, result)
+	}
+	err = filepath.WalkDir(targetTarDir, func(path string, d os.DirEntry, err error) error {
+		// 没有 _appDataTar 的模块（联系人、短信等）没有分片
+		if path == targetTarDir && errors.Is(err, fs.ErrNotExist) {
+			slog.Debug("module has no chunks", "dir", targetTarDir)
+			return nil
+		}
+		// 忽略目录遍历中的错误，继续处理其他文件
+		if err != nil {
+			slog.Warn("walk error, skipping", "path", path, "err", err)
+			rel, _ := filepath.Rel(inputPath, path)
+			report(chunkResult{File: filepath.ToSlash(rel), Module: fileModuleInfo.Name, Errors: []string{err.Error()}})
+			return nil
+		}
+
+		// 跳过目录本身，只处理文件
+		if d.IsDir() {
+			return nil
+		}
+
+		// 只处理 .tar 文件
+		if !strings.HasSuffix(d.Name(), ".tar") {
+			return nil
+		}
+
+		// 计算相对路径（相对于原始 inputPath）
+		relPath, err := filepath.Rel(inputPath, path)
+		if err != nil {
+			slog.Warn("failed to get relative path, skipping", "path", path, "err", err)
+			return nil
+		}
+		chunk := chunkResult{File: filepath.ToSlash(relPath), Module: fileModuleInfo.Name}
+		fail := func(err error) {
+			chunk.Errors = append(chunk.Errors, err.Error())
+		}
+
+		checkMsgV3Item, hasHmac := checkMsgV3Items[d.Name()]
+		var mac hash.Hash
+		if hasHmac {
+			mac = crypto.newHmac(checkMsgV3Item)
+		}
+
+		var result utils.VerifyResult
+		if verifyOnly {
+			// 只校验，明文不写出
+			slog.Info("verifying", "file", path)
+			var tarErr error
+			result, chunk.Entries, tarErr, err = verifyChunk(path, crypto, mac)
+			if err == nil && tarErr != nil {
+				slog.Error("invalid tar", "file", path, "err", tarErr)
+				fail(fmt.Errorf("invalid tar: %w", tarErr))
+			}
+		} else {
+			// 构建输出文件路径
+			outputFilePath := filepath.Join(outputDir, relPath)
+
+			// 确保输出文件的父目录存在
+			outputDirPath := filepath.Dir(outputFilePath)
+			err = os.MkdirAll(outputDirPath, 0755)
+			if err != nil {
+				slog.Error("failed to create output subdirectory, skipping", "dir", outputDirPath, "err", err)
+				fail(err)
+				report(chunk)
+				return nil
+			}
+
+			// 解密文件，同时校验 checkMsgV3 HMAC 和 GCM tag，只读取一次密文
+			slog.Info("decrypting", "file", path, "output", outputFilePath)
+			result, err = utils.DecryptVerifyFile(path, outputFilePath, crypto.key, crypto.iv, utils.ALGO_AES_GCM, mac)
+		}
+		if err != nil {
+			slog.Error("failed to decrypt, skipping", "file", path, "err", err)
+			fail(err)
+			report(chunk)
+			return nil
+		}
+
+		switch {
+		case !hasHmac:
+			slog.Warn("no checkMsgV3 entry", "file", path)
+		case mac == nil:
+			slog.Debug("no HMAC key, checkMsgV3 not checked", "file", path)
+		case checkMsgV3Item.Verify(result.Hmac):
+			slog.Debug("checkMsgV3 OK", "file", path)
+		default:
+			slog.Error("checkMsgV3 hash mismatch", "file", path, "hmac", fmt.Sprintf("%X", result.Hmac))
+			fail(errors.New("checkMsgV3 hash mismatch"))
+		}
+
+		if result.TagErr != nil {
+			slog.Error("GCM tag verification failed, skipping", "file", path, "err", result.TagErr)
+			fail(fmt.Errorf("GCM tag verification failed: %w", result.TagErr))
+		} else {
+			slog.Debug("GCM tag OK", "file", path)
+		}
+		report(chunk)
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("WalkDir Failed: %w", err)
+	}
+
+	return nil
+}
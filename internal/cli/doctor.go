@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/doctor"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+var doctorCommand = &Command{
+	Name:  "doctor",
+	Short: "Cross-check backupinfo.ini, info.xml and the files on disk",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		return func(g *Globals) error {
+			return runDoctor(g, *argInput)
+		}
+	},
+}
+
+func runDoctor(g *Globals, input string) error {
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+
+	var findings []doctor.Finding
+
+	// backupinfo.ini 缺失或有错误时仍然检查其余部分
+	backupInfo, problems, err := parseBackupInfo(b)
+	if err != nil {
+		return err
+	}
+	if backupInfo == nil {
+		findings = append(findings, doctor.Finding{
+			Severity: infoxml.SeverityWarning,
+			Kind:     doctor.KindMetadata,
+			Path:     "backupinfo.ini",
+			Message:  "file does not exist, skipping backupinfo.ini checks",
+		})
+	}
+	if problems != nil {
+		findings = append(findings, doctor.Finding{
+			Severity: infoxml.SeverityError,
+			Kind:     doctor.KindMetadata,
+			Path:     "backupinfo.ini",
+			Message:  problems.Error(),
+		})
+	}
+
+	checked, err := doctor.Check(b, backupInfo)
+	if err != nil {
+		return fmt.Errorf("Failed to check backup: %w", err)
+	}
+	findings = append(findings, checked...)
+
+	if g.JSON() {
+		if findings == nil {
+			findings = []doctor.Finding{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(findings)
+		if err != nil {
+			return fmt.Errorf("Failed to encode findings: %w", err)
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+	}
+
+	if doctor.HasErrors(findings) {
+		return errFailed
+	}
+	if !g.JSON() {
+		slog.Info("no errors found", "warnings", len(findings))
+	}
+	return nil
+}
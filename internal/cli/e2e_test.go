@@ -0,0 +1,457 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// newFixture 生成使用 fixture.Password 的备份，返回备份和打开的 Backup
+func newFixture(t *testing.T) (*fixture.Fixture, *backup.Backup) {
+	t.Helper()
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := backup.Open(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, b
+}
+
+// sortedChunks 返回 fixture 中所有分片的相对路径
+func sortedChunks(f *fixture.Fixture) []string {
+	rels := make([]string, 0, len(f.Chunks))
+	for rel := range f.Chunks {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+// runCaptured 运行 Main，返回退出码和标准输出
+func runCaptured(t *testing.T, args []string) (int, []byte) {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	got := Main(args)
+	os.Stdout = stdout
+
+	raw, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, raw
+}
+
+// corruptChunk 修改分片中间的一个字节，大小不变
+func corruptChunk(t *testing.T, f *fixture.Fixture, rel string) {
+	t.Helper()
+	path := filepath.Join(f.Dir, filepath.FromSlash(rel))
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)/2] ^= 0xff
+	err = os.WriteFile(path, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 文件系统的时间精度可能比写入间隔粗，明确修改时间
+	later := info.ModTime().Add(time.Second)
+	err = os.Chtimes(path, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestE2EVerify 检查 verify 接受生成的分片，拒绝被修改的分片
+func TestE2EVerify(t *testing.T) {
+	f, b := newFixture(t)
+	for _, module := range b.Modules {
+		chunks, err := b.ChunkFiles(module.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			args := []string{"verify", "--quiet", "--password", f.Password, "--checkMsgV3", module.CheckMsgV3, "--input", chunk}
+			if got := Main(args); got != 0 {
+				t.Errorf("verify %s = %d, want 0", chunk, got)
+			}
+			wrong := []string{"verify", "--quiet", "--password", "wrong", "--checkMsgV3", module.CheckMsgV3, "--input", chunk}
+			if got := Main(wrong); got != 1 {
+				t.Errorf("verify %s with wrong password = %d, want 1", chunk, got)
+			}
+		}
+	}
+
+	// 修改一个字节后 HMAC 不再匹配
+	rel := sortedChunks(f)[0]
+	path := filepath.Join(f.Dir, filepath.FromSlash(rel))
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)/2] ^= 0xff
+	err = os.WriteFile(path, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := b.Modules[0]
+	for _, m := range b.Modules {
+		if filepath.Base(filepath.Dir(path)) == m.Name+"_appDataTar" {
+			module = m
+		}
+	}
+	args := []string{"verify", "--quiet", "--password", f.Password, "--checkMsgV3", module.CheckMsgV3, "--input", path}
+	if got := Main(args); got != 1 {
+		t.Errorf("verify corrupted %s = %d, want 1", rel, got)
+	}
+}
+
+// TestE2EDecrypt 检查 decrypt 逐个解密分片并校验 HMAC，输出与明文一致
+func TestE2EDecrypt(t *testing.T) {
+	f, b := newFixture(t)
+	out := t.TempDir()
+	for _, module := range b.Modules {
+		chunks, err := b.ChunkFiles(module.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			rel, _ := filepath.Rel(f.Dir, chunk)
+			output := filepath.Join(out, filepath.Base(chunk))
+			args := []string{"decrypt", "--quiet", "--password", f.Password,
+				"--encMsgV3", module.EncMsgV3, "--checkMsgV3", module.CheckMsgV3,
+				"--input", chunk, "--output", output}
+			if got := Main(args); got != 0 {
+				t.Fatalf("decrypt %s = %d, want 0", rel, got)
+			}
+			plain, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plain, f.Chunks[filepath.ToSlash(rel)]) {
+				t.Errorf("decrypt %s: plaintext mismatch", rel)
+			}
+		}
+	}
+}
+
+// TestE2EDecryptDir 检查 decrypt-dir 解密所有模块，输出与明文一致
+func TestE2EDecryptDir(t *testing.T) {
+	f, _ := newFixture(t)
+	args := []string{"decrypt-dir", "--quiet", "--password", f.Password, "--input", f.Dir}
+	if got := Main(args); got != 0 {
+		t.Fatalf("decrypt-dir = %d, want 0", got)
+	}
+
+	outputDir := f.Dir + "_decrypted"
+	for _, rel := range sortedChunks(f) {
+		plain, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Errorf("decrypt-dir: %v", err)
+			continue
+		}
+		if !bytes.Equal(plain, f.Chunks[rel]) {
+			t.Errorf("decrypt-dir %s: plaintext mismatch", rel)
+		}
+	}
+
+	// 找出密码后解密
+	list := filepath.Join(t.TempDir(), "passwords.txt")
+	err := os.WriteFile(list, []byte("wrong\n"+f.Password+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.RemoveAll(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args = []string{"decrypt-dir", "--quiet", "--password-list", list, "--input", f.Dir}
+	if got := Main(args); got != 0 {
+		t.Fatalf("decrypt-dir --password-list = %d, want 0", got)
+	}
+	rel := sortedChunks(f)[0]
+	plain, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(rel)))
+	if err != nil || !bytes.Equal(plain, f.Chunks[rel]) {
+		t.Errorf("decrypt-dir --password-list %s: plaintext mismatch, err %v", rel, err)
+	}
+
+	// 修改一个字节后其他分片仍然解密，退出码为 1
+	corruptChunk(t, f, rel)
+	err = os.RemoveAll(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args = []string{"decrypt-dir", "--quiet", "--password", f.Password, "--input", f.Dir}
+	if got := Main(args); got != 1 {
+		t.Errorf("decrypt-dir with a corrupted chunk = %d, want 1", got)
+	}
+	for _, other := range sortedChunks(f)[1:] {
+		plain, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(other)))
+		if err != nil || !bytes.Equal(plain, f.Chunks[other]) {
+			t.Errorf("decrypt-dir %s after a corrupted chunk: plaintext mismatch, err %v", other, err)
+		}
+	}
+}
+
+// TestE2EDecryptDirVerifyOnly 检查 decrypt-dir --verify-only 不写出明文，并报告被修改的分片和不是 tar 的分片
+func TestE2EDecryptDirVerifyOnly(t *testing.T) {
+	f, b := newFixture(t)
+	args := []string{"decrypt-dir", "--quiet", "--verify-only", "--password", f.Password, "--input", f.Dir}
+	if got := Main(args); got != 0 {
+		t.Fatalf("decrypt-dir --verify-only = %d, want 0", got)
+	}
+	if _, err := os.Stat(f.Dir + "_decrypted"); !os.IsNotExist(err) {
+		t.Errorf("decrypt-dir --verify-only created the output directory: %v", err)
+	}
+
+	// 修改一个字节后 GCM tag 和 HMAC 都不再匹配
+	rels := sortedChunks(f)
+	corrupted := rels[0]
+	corruptChunk(t, f, corrupted)
+
+	// 用正确的密钥和 HMAC 加密不是 tar 的内容，只有 tar 检查能发现
+	notTar := "com.example.notes_appDataTar/com.example.notes0.tar"
+	ix, err := infoxml.Parse(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var module infoxml.BackupFileModuleInfo
+	for _, m := range b.Modules {
+		if m.Name == "com.example.notes" {
+			module = m
+		}
+	}
+	key, iv, err := backup.ModuleKey(f.Password, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := internal.NewCheckMsgV3Item(filepath.Base(notTar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := item.NewHmac(f.Password)
+	var encrypted bytes.Buffer
+	w, err := utils.NewEncryptWriter(io.MultiWriter(&encrypted, mac), key, iv, utils.ALGO_AES_GCM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(bytes.Repeat([]byte("not a tar\n"), 100))
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.ExpectedHmac = mac.Sum(nil)
+	err = os.WriteFile(filepath.Join(f.Dir, filepath.FromSlash(notTar)), encrypted.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ix.Rows {
+		if name, _ := ix.Rows[i].GetColumnString("name"); ix.Rows[i].Table == "BackupFileModuleInfo" && name == module.Name {
+			ix.Rows[i].SetColumnValue("checkMsgV3", infoxml.StringValue(internal.FormatCheckMsgV3([]internal.CheckMsgV3Item{item})))
+		}
+	}
+	err = ix.WriteFile(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, raw := runCaptured(t, []string{"decrypt-dir", "--quiet", "--format", "json", "--verify-only", "--password", f.Password, "--input", f.Dir})
+	if got != 1 {
+		t.Errorf("decrypt-dir --verify-only with bad chunks = %d, want 1", got)
+	}
+	var results []chunkResult
+	err = json.Unmarshal(raw, &results)
+	if err != nil {
+		t.Fatalf("%v: %s", err, raw)
+	}
+	if len(results) != len(rels) {
+		t.Errorf("got %d results, want %d", len(results), len(rels))
+	}
+	for _, result := range results {
+		bad := result.File == corrupted || result.File == notTar
+		if bad != (len(result.Errors) > 0) {
+			t.Errorf("%s: errors %q", result.File, result.Errors)
+		}
+		if result.File == corrupted && len(result.Errors) < 2 {
+			t.Errorf("%s: want HMAC and GCM tag errors, got %q", result.File, result.Errors)
+		}
+		if !bad && result.Entries != len(f.Entries[result.File]) {
+			t.Errorf("%s: %d entries, want %d", result.File, result.Entries, len(f.Entries[result.File]))
+		}
+	}
+	if _, err := os.Stat(f.Dir + "_decrypted"); !os.IsNotExist(err) {
+		t.Errorf("decrypt-dir --verify-only created the output directory: %v", err)
+	}
+}
+
+// TestE2ELs 检查 ls 列出所有分片的条目，只在 --save-index 时保存索引，分片被修改后索引失效，
+// 校验失败的分片不列出并且退出码为 1
+func TestE2ELs(t *testing.T) {
+	f, _ := newFixture(t)
+	args := []string{"ls", "--quiet", "--format", "json", "--password", f.Password, "--input", f.Dir}
+	got, raw := runCaptured(t, args)
+	if got != 0 {
+		t.Fatalf("ls = %d, want 0", got)
+	}
+	if len(lsChunks(t, raw)) != len(f.Chunks) {
+		t.Errorf("ls listed %d chunks, want %d", len(lsChunks(t, raw)), len(f.Chunks))
+	}
+	// 没有要求时不在备份目录中写入任何内容
+	if _, err := os.Stat(filepath.Join(f.Dir, backup.IndexDirName)); !os.IsNotExist(err) {
+		t.Errorf("ls without --save-index created the index directory: %v", err)
+	}
+
+	args = append(args, "--save-index")
+	got, raw = runCaptured(t, args)
+	if got != 0 {
+		t.Fatalf("ls = %d, want 0", got)
+	}
+	listed := lsChunks(t, raw)
+	for rel, entries := range f.Entries {
+		if listed[path.Base(rel)] != len(entries) {
+			t.Errorf("ls %s: listed %d entries, want %d", rel, listed[path.Base(rel)], len(entries))
+		}
+	}
+
+	// --save-index 保存了索引
+	indexes, err := filepath.Glob(filepath.Join(f.Dir, backup.IndexDirName, "*.json"))
+	if err != nil || len(indexes) != len(f.Chunks) {
+		t.Errorf("ls saved %d indexes, want %d, err %v", len(indexes), len(f.Chunks), err)
+	}
+
+	rel := sortedChunks(f)[0]
+	corruptChunk(t, f, rel)
+	got, raw = runCaptured(t, args)
+	if got != 1 {
+		t.Errorf("ls with a corrupted chunk = %d, want 1", got)
+	}
+	listed = lsChunks(t, raw)
+	if listed[path.Base(rel)] != 0 {
+		t.Errorf("ls listed %d entries of the corrupted chunk %s", listed[path.Base(rel)], rel)
+	}
+	if len(listed) != len(f.Chunks)-1 {
+		t.Errorf("ls listed %d chunks, want %d", len(listed), len(f.Chunks)-1)
+	}
+}
+
+// lsChunks 统计 ls JSON 输出中每个分片的条目数
+func lsChunks(t *testing.T, raw []byte) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for dec.More() {
+		var item listItem
+		err := dec.Decode(&item)
+		if err != nil {
+			t.Fatalf("%v: %s", err, raw)
+		}
+		counts[item.Chunk]++
+	}
+	return counts
+}
+
+// TestE2EExtract 检查 extract 写出匹配的条目，只在 --save-index 时保存索引，分片被修改后不写出未经认证的数据
+func TestE2EExtract(t *testing.T) {
+	f, _ := newFixture(t)
+	rel := "com.tencent.mm_appDataTar/com.tencent.mm1.tar"
+	extract := func(out string, extra ...string) int {
+		return Main(append([]string{"extract", "--quiet", "--password", f.Password, "--input", f.Dir,
+			"--module", "com.tencent.mm", "--path", "data/data/com.tencent.mm/files/chunk1/*", "--out", out}, extra...))
+	}
+	check := func(out string) {
+		t.Helper()
+		for name, content := range f.Entries[rel] {
+			got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+			if err != nil || !bytes.Equal(got, content) {
+				t.Errorf("%s: content mismatch, err %v", name, err)
+			}
+		}
+		staging, _ := filepath.Glob(filepath.Join(out, ".kobackup-extract-*"))
+		if len(staging) != 0 {
+			t.Errorf("staging directories left: %v", staging)
+		}
+	}
+
+	// 没有索引时解密整个分片，默认不保存索引
+	out := filepath.Join(t.TempDir(), "out")
+	if got := extract(out); got != 0 {
+		t.Fatalf("extract = %d, want 0", got)
+	}
+	check(out)
+	if _, err := os.Stat(filepath.Join(f.Dir, backup.IndexDirName)); !os.IsNotExist(err) {
+		t.Errorf("extract without --save-index created the index directory: %v", err)
+	}
+
+	out = filepath.Join(t.TempDir(), "out")
+	if got := extract(out, "--save-index"); got != 0 {
+		t.Fatalf("extract --save-index = %d, want 0", got)
+	}
+	check(out)
+	indexes, _ := filepath.Glob(filepath.Join(f.Dir, backup.IndexDirName, "*.json"))
+	if len(indexes) != 3 {
+		t.Errorf("extract saved %d indexes, want 3", len(indexes))
+	}
+
+	// 第二次使用索引
+	out = filepath.Join(t.TempDir(), "out")
+	if got := extract(out); got != 0 {
+		t.Fatalf("extract with index = %d, want 0", got)
+	}
+	check(out)
+
+	// 索引失效，重新解密时校验失败，不写出任何条目
+	corruptChunk(t, f, rel)
+	out = filepath.Join(t.TempDir(), "out")
+	if got := extract(out); got != 1 {
+		t.Errorf("extract from a corrupted chunk = %d, want 1", got)
+	}
+	entries, _ := os.ReadDir(out)
+	if len(entries) != 0 {
+		t.Errorf("extract from a corrupted chunk wrote %v", entries)
+	}
+}
+
+// TestE2EFixtureCommand 检查 fixture 命令生成的备份可以用默认密码找到
+func TestE2EFixtureCommand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	if got := Main([]string{"fixture", "--quiet", "--output", dir}); got != 0 {
+		t.Fatalf("fixture = %d, want 0", got)
+	}
+	b, err := backup.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, found, _, err := findPassword(b, []string{"wrong", fixture.Password}, 1)
+	if err != nil || !found || password != fixture.Password {
+		t.Errorf("findPassword = %q, %v, %v", password, found, err)
+	}
+
+	if got := Main([]string{"fixture", "--quiet", "--output", dir}); got != 1 {
+		t.Errorf("fixture into existing directory = %d, want 1", got)
+	}
+}
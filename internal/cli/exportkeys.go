@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+)
+
+var exportKeysCommand = &Command{
+	Name:  "export-keys",
+	Short: "Derive the module AES and HMAC keys into a keyfile for decrypt and decrypt-dir",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argOutput := fs.String("output", "", "Output keyfile path, created with mode 0600")
+		argModule := fs.String("module", "", "Only export the given package name (default: all modules)")
+		argEncrypt := fs.Bool("encrypt", false, "Encrypt the keyfile with a passphrase from --keyfile-passphrase-* or "+KeyFilePassphraseEnv)
+		var passphrase passphraseFlags
+		passphrase.register(fs)
+		return func(g *Globals) error {
+			if *argOutput == "" {
+				return usageErrorf("--output is required")
+			}
+			return runExportKeys(g, *argInput, *argOutput, *argModule, *argEncrypt, &passphrase)
+		}
+	},
+}
+
+func runExportKeys(g *Globals, input string, output string, moduleName string, encrypt bool, passphrase *passphraseFlags) error {
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	modules, err := b.SelectModules(moduleName)
+	if err != nil {
+		return err
+	}
+
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+	pass := ""
+	if encrypt {
+		pass, err = passphrase.read()
+		if err != nil {
+			return err
+		}
+	}
+
+	keyFile, err := b.DeriveKeys(password, modules)
+	if errors.Is(err, backup.ErrWrongPassword) {
+		return errors.New("the password does not match the backup")
+	}
+	if err != nil {
+		return err
+	}
+	err = keyFile.WriteFile(output, pass)
+	if err != nil {
+		return fmt.Errorf("write keyfile: %w", err)
+	}
+
+	slog.Info("keys exported", "output", output, "modules", len(keyFile.Modules), "encrypted", encrypt)
+	return nil
+}
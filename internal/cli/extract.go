@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"archive/tar"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+var extractCommand = &Command{
+	Name:  "extract",
+	Short: "Extract files from a module by in-archive path",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argModule := fs.String("module", "", "Package name of the module to extract from")
+		argPath := fs.String("path", "", "Glob of in-archive paths to extract")
+		argOut := fs.String("out", "", "Output directory path")
+		argIndexDir := fs.String("index-dir", "", "Directory of index files built by the index command (default: <input>/.kobackup-index)")
+		argSaveIndex := fs.Bool("save-index", false, "Save the index of chunks decrypted without one to --index-dir")
+		return func(g *Globals) error {
+			if *argModule == "" || *argPath == "" || *argOut == "" {
+				return usageErrorf("--module, --path and --out are required")
+			}
+			return runExtract(g, *argInput, *argModule, *argPath, *argOut, *argIndexDir, *argSaveIndex)
+		}
+	},
+}
+
+func runExtract(g *Globals, input string, moduleName string, pathGlob string, outDir string, indexDir string, save bool) error {
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+
+	// 检查 path 是否合法
+	_, err = archive.Match(pathGlob, "")
+	if err != nil {
+		return usageErrorf("Invalid path glob: %v", err)
+	}
+
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	module, err := b.Module(moduleName)
+	if err != nil {
+		return err
+	}
+
+	key, iv, err := backup.ModuleKey(password, *module)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := b.ChunkFiles(module.Name)
+	if err != nil {
+		return fmt.Errorf("Failed to find chunks of %s: %w", module.Name, err)
+	}
+
+	if indexDir == "" {
+		indexDir = b.DefaultIndexDir()
+	}
+
+	// 没有 checkMsgV3 时无法使用索引，直接解密
+	items, err := backup.ChunkItems(*module)
+	if err != nil {
+		slog.Warn("invalid checkMsgV3, not using index", "module", module.Name, "err", err)
+	}
+
+	match := func(entry archive.Entry) bool {
+		ok, _ := archive.Match(pathGlob, entry.Name)
+		return ok
+	}
+
+	total := 0
+	failed := false
+	for _, chunk := range chunks {
+		item := chunkItem(items, chunk)
+		index := validIndex(indexDir, item, chunk)
+
+		var extracted []archive.Entry
+		if index != nil {
+			extracted, err = extractIndexedChunk(chunk, key, iv, index, match, outDir)
+		} else {
+			// 没有有效的索引时解密整个分片，--save-index 时保存同时建立的索引，下次只解密匹配的条目
+			extracted, index, err = extractChunk(chunk, key, iv, item, password, match, outDir)
+			if err == nil && save {
+				saveIndex(indexDir, index, chunk)
+			}
+		}
+		for _, entry := range extracted {
+			slog.Info("extracted", "path", entry.Name)
+		}
+		total += len(extracted)
+		if err != nil {
+			slog.Error("failed to extract", "chunk", chunk, "err", err)
+			failed = true
+		}
+	}
+
+	if total == 0 {
+		slog.Error("no entry matches", "path", pathGlob)
+		failed = true
+	}
+	if failed {
+		return errFailed
+	}
+
+	slog.Info("extraction completed", "entries", total, "output", outDir)
+	return nil
+}
+
+// extractChunk 流式解密整个分片，匹配的条目先写入 outDir 下的临时目录，
+// GCM tag 和 checkMsgV3 HMAC 都校验通过后才移动到输出位置
+//
+//	r1 []archive.Entry 已写入的条目
+//	r2 *archive.Index 分片的索引
+//	r3 error
+func extractChunk(chunk string, key []byte, iv []byte, item *internal.CheckMsgV3Item, password string, match func(archive.Entry) bool, outDir string) ([]archive.Entry, *archive.Index, error) {
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+	staging, err := os.MkdirTemp(outDir, ".kobackup-extract-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	var staged []archive.Entry
+	index, err := backup.ScanChunk(chunk, key, iv, item, password, func(entry archive.Entry, data io.Reader) error {
+		if !match(entry) {
+			return nil
+		}
+		err := archive.WriteEntry(data, entry, staging)
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", entry.Name, err)
+		}
+		staged = append(staged, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var extracted []archive.Entry
+	moved := map[string]bool{}
+	for _, entry := range staged {
+		name := archive.CleanName(entry.Name)
+		if name == "" || moved[name] {
+			// 根目录，或者重复的条目（临时目录中已经是最后一个）
+			continue
+		}
+		err := moveEntry(staging, entry, outDir)
+		if err != nil {
+			return extracted, nil, fmt.Errorf("extract %s: %w", entry.Name, err)
+		}
+		moved[name] = true
+		extracted = append(extracted, entry)
+	}
+	return extracted, index, nil
+}
+
+// moveEntry 把 WriteEntry 写入 staging 的条目移动到 outDir 下对应的路径
+func moveEntry(staging string, entry archive.Entry, outDir string) error {
+	outPath, err := archive.OutputPath(outDir, entry.Name)
+	if err != nil {
+		return err
+	}
+	if entry.Typeflag == tar.TypeDir {
+		return os.MkdirAll(outPath, 0755)
+	}
+
+	stagedPath, err := archive.OutputPath(staging, entry.Name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(outPath), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(stagedPath, outPath)
+}
+
+// extractIndexedChunk 根据索引随机访问分片，只解密匹配条目的数据
+//
+// 不读取整个分片，因此不会校验 GCM tag 和 HMAC。建立索引时分片已经通过这两项校验，
+// LoadChunkIndex 也确认了分片的 HMAC、大小和修改时间与当时一致，否则不会使用索引
+func extractIndexedChunk(chunk string, key []byte, iv []byte, index *archive.Index, match func(archive.Entry) bool, outDir string) ([]archive.Entry, error) {
+	var matched []archive.Entry
+	for _, entry := range index.Entries {
+		if match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+
+	plain, inFile, err := utils.OpenCipherReaderAt(chunk, key, iv, utils.ALGO_AES_GCM)
+	if err != nil {
+		return nil, err
+	}
+	defer inFile.Close()
+
+	var extracted []archive.Entry
+	for _, entry := range matched {
+		data := io.NewSectionReader(plain, entry.DataOffset, entry.Size)
+		err := archive.WriteEntry(data, entry, outDir)
+		if err != nil {
+			return extracted, fmt.Errorf("extract %s: %w", entry.Name, err)
+		}
+		extracted = append(extracted, entry)
+	}
+	return extracted, nil
+}
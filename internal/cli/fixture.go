@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+)
+
+var fixtureCommand = &Command{
+	Name:  "fixture",
+	Short: "Generate a synthetic encrypted backup with a known password for testing",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argOutput := fs.String("output", "", "Output backup directory, must not exist")
+		return func(g *Globals) error {
+			if *argOutput == "" {
+				return usageErrorf("--output is required")
+			}
+			return runFixture(g, *argOutput)
+		}
+	},
+}
+
+func runFixture(g *Globals, output string) error {
+	// 没有显式指定密码时使用 fixture.Password，不提示输入
+	password := fixture.Password
+	if g.passwordGiven() {
+		var err error
+		password, err = g.ReadPassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := fixture.Generate(output, fixture.Options{Password: password})
+	if err != nil {
+		return fmt.Errorf("Failed to generate fixture: %w", err)
+	}
+
+	slog.Info("fixture generated", "output", f.Dir, "modules", len(f.Modules), "chunks", len(f.Chunks))
+	return nil
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+)
+
+var indexCommand = &Command{
+	Name:  "index",
+	Short: "Build entry indexes of the encrypted tars for ls and extract",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argModule := fs.String("module", "", "Only index the given package name (default: all modules)")
+		argIndexDir := fs.String("index-dir", "", "Directory to store index files (default: <input>/.kobackup-index)")
+		argForce := fs.Bool("force", false, "Rebuild indexes that are still up to date")
+		return func(g *Globals) error {
+			return runIndex(g, *argInput, *argModule, *argIndexDir, *argForce)
+		}
+	},
+}
+
+func runIndex(g *Globals, input string, moduleName string, indexDir string, force bool) error {
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	modules, err := b.SelectModules(moduleName)
+	if err != nil {
+		return err
+	}
+
+	if indexDir == "" {
+		indexDir = b.DefaultIndexDir()
+	}
+
+	failed := false
+	for _, module := range modules {
+		key, iv, err := backup.ModuleKey(password, module)
+		if err != nil {
+			slog.Error(err.Error())
+			failed = true
+			continue
+		}
+
+		items, err := backup.ChunkItems(module)
+		if err != nil {
+			slog.Error("invalid checkMsgV3", "module", module.Name, "err", err)
+			failed = true
+			continue
+		}
+
+		chunks, err := b.ChunkFiles(module.Name)
+		if err != nil {
+			slog.Error("failed to find chunks", "module", module.Name, "err", err)
+			failed = true
+			continue
+		}
+
+		for _, chunk := range chunks {
+			// 索引以 checkMsgV3 HMAC 为键，没有 HMAC 的分片无法建立索引
+			item, ok := items[filepath.Base(chunk)]
+			if !ok {
+				slog.Warn("no checkMsgV3 entry, skipping", "chunk", chunk)
+				continue
+			}
+
+			if !force {
+				index, err := backup.LoadChunkIndex(indexDir, item.ExpectedHmac, chunk)
+				switch {
+				case err == nil && index != nil:
+					slog.Info("index up to date", "chunk", chunk)
+					continue
+				case errors.Is(err, backup.ErrIndexStale):
+					slog.Info("index out of date, rebuilding", "chunk", chunk)
+				}
+			}
+
+			// 只为 GCM tag 和 HMAC 都校验通过的分片建立索引
+			index, err := backup.ScanChunk(chunk, key, iv, &item, password, nil)
+			if err != nil {
+				slog.Error("failed to index", "chunk", chunk, "err", err)
+				failed = true
+				continue
+			}
+
+			err = backup.SaveChunkIndex(indexDir, index)
+			if err != nil {
+				slog.Error("failed to save index", "chunk", chunk, "err", err)
+				failed = true
+				continue
+			}
+			slog.Info("indexed", "chunk", chunk, "entries", len(index.Entries))
+		}
+	}
+
+	if failed {
+		return errFailed
+	}
+	slog.Info("indexing completed")
+	return nil
+}
+
+// chunkItem 返回分片的 checkMsgV3 项，没有时返回 nil
+func chunkItem(items map[string]internal.CheckMsgV3Item, chunk string) *internal.CheckMsgV3Item {
+	item, ok := items[filepath.Base(chunk)]
+	if !ok {
+		slog.Warn("no checkMsgV3 entry, HMAC will not be checked", "chunk", chunk)
+		return nil
+	}
+	return &item
+}
+
+// validIndex 返回分片仍然有效的索引，没有或者已经失效时返回 nil
+func validIndex(indexDir string, item *internal.CheckMsgV3Item, chunk string) *archive.Index {
+	if item == nil {
+		return nil
+	}
+	index, err := backup.LoadChunkIndex(indexDir, item.ExpectedHmac, chunk)
+	switch {
+	case errors.Is(err, backup.ErrIndexStale):
+		slog.Warn("index out of date, decrypting the chunk", "chunk", chunk)
+	case err != nil:
+		slog.Warn("failed to load index, decrypting the chunk", "chunk", chunk, "err", err)
+	}
+	return index
+}
+
+// saveIndex 保存校验通过的分片的索引，没有 checkMsgV3 HMAC 时跳过，失败时只警告
+func saveIndex(indexDir string, index *archive.Index, chunk string) {
+	if index.Hmac == "" {
+		return
+	}
+	err := backup.SaveChunkIndex(indexDir, index)
+	if err != nil {
+		slog.Warn("failed to save index", "chunk", chunk, "err", err)
+	}
+}
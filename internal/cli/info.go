@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+)
+
+var infoCommand = &Command{
+	Name:  "info",
+	Short: "Show the device, backup time and modules of a backup",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		return func(g *Globals) error {
+			return runInfo(g, *argInput)
+		}
+	},
+}
+
+func runInfo(g *Globals, input string) error {
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+
+	backupInfo, problems, err := parseBackupInfo(b)
+	if err != nil {
+		return err
+	}
+	if problems != nil {
+		slog.Warn("backupinfo.ini has errors", "err", problems)
+	}
+
+	summary, err := b.Summary(backupInfo)
+	if err != nil {
+		return fmt.Errorf("Failed to read info.xml: %w", err)
+	}
+
+	if g.JSON() {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(summary)
+		if err != nil {
+			return fmt.Errorf("Failed to encode summary: %w", err)
+		}
+		return nil
+	}
+
+	err = printSummary(summary)
+	if err != nil {
+		return fmt.Errorf("Failed to print summary: %w", err)
+	}
+	return nil
+}
+
+// parseBackupInfo 读取备份目录下的 backupinfo.ini，info 和 doctor 共用
+//
+//	r1 *backupinfo.BackupInfo 文件不存在时为 nil
+//	r2 error 语法或类型错误，此时 r1 是能解析的部分
+//	r3 error 无法读取或解析文件
+func parseBackupInfo(b *backup.Backup) (*backupinfo.BackupInfo, error, error) {
+	backupInfo, err := backupinfo.Parse(filepath.Join(b.Dir, "backupinfo.ini"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil, nil
+	case err != nil && backupInfo == nil:
+		return nil, nil, fmt.Errorf("Failed to parse backupinfo.ini: %w", err)
+	}
+	return backupInfo, err, nil
+}
+
+func printSummary(s *backup.Summary) error {
+	tw := newTable(os.Stdout)
+
+	device := s.Device
+	fmt.Fprintf(tw, "Device:\t%s %s (%s)\n", device.Brand, device.Model, device.DeviceId)
+	fmt.Fprintf(tw, "Manufacturer:\t%s\n", device.Manufacturer)
+	fmt.Fprintf(tw, "System:\tAndroid %s (SDK %d), %s\n", device.VersionRelease, device.VersionSdk, device.DisplayId)
+	if s.DateTime != nil {
+		fmt.Fprintf(tw, "Backup time:\t%s\n", s.DateTime.Local().Format(time.DateTime+" -0700"))
+	} else {
+		fmt.Fprintf(tw, "Backup time:\t-\n")
+	}
+	fmt.Fprintf(tw, "Backup version:\t%d (%s)\n", s.BackupVersion, s.BackupVersionName)
+	fmt.Fprintf(tw, "HiSuite version:\t%s\n", s.HisuiteVersion)
+	fmt.Fprintf(tw, "Encryption type:\t%d\n", s.EncryptType)
+	fmt.Fprintf(tw, "Selected data size:\t%d\n", s.SelectDataSize)
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	tw = newTable(os.Stdout)
+	fmt.Fprintf(tw, "MODULE\tAPP\tVERSION\tAPK SIZE\tDB SIZE\tCHUNKS\n")
+	for _, m := range s.Modules {
+		version := "-"
+		if m.VersionName != "" || m.VersionCode != 0 {
+			version = fmt.Sprintf("%s (%d)", m.VersionName, m.VersionCode)
+		}
+		appName := m.AppName
+		if appName == "" {
+			appName = "-"
+		}
+		name := m.Name
+		if !m.InInfoXml {
+			// 只在 backupinfo.ini 中出现
+			name += "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\n", name, appName, version, m.ApkSize, m.DbSize, m.Chunks)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"log/slog"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/logging"
+)
+
+// KeyFilePassphraseEnv 保存 keyfile passphrase 的环境变量
+const KeyFilePassphraseEnv = "KOBACKUP_KEYFILE_PASSPHRASE"
+
+// passphraseFlags 加密 keyfile 的 passphrase 来源，没有直接写在命令行上的参数
+type passphraseFlags struct {
+	File    string
+	Fd      int
+	Command string
+
+	passphrase *string // 已读取的 passphrase
+}
+
+func (p *passphraseFlags) register(fs *flag.FlagSet) {
+	p.Fd = -1
+	fs.StringVar(&p.File, "keyfile-passphrase-file", "", "Read the keyfile passphrase from this file")
+	fs.IntVar(&p.Fd, "keyfile-passphrase-fd", -1, "Read the keyfile passphrase from this file descriptor")
+	fs.StringVar(&p.Command, "keyfile-passphrase-command", "", "Run this shell command and use its stdout as the keyfile passphrase")
+}
+
+// read 返回 passphrase，结果会被缓存
+//
+// 依次使用 --keyfile-passphrase-file、--keyfile-passphrase-fd、--keyfile-passphrase-command、
+// 环境变量 KOBACKUP_KEYFILE_PASSPHRASE，最后在终端上提示输入
+func (p *passphraseFlags) read() (string, error) {
+	if p.passphrase != nil {
+		return *p.passphrase, nil
+	}
+	passphrase, err := secretSource{
+		name:    "keyfile-passphrase",
+		env:     KeyFilePassphraseEnv,
+		File:    p.File,
+		Fd:      p.Fd,
+		Command: p.Command,
+	}.read()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("keyfile passphrase is empty")
+	}
+	p.passphrase = &passphrase
+	return passphrase, nil
+}
+
+// keyFlags 用 AES 密钥或 keyfile 代替密码，跳过 pbkdf2
+type keyFlags struct {
+	KeyHex     string
+	KeyFile    string
+	passphrase passphraseFlags
+
+	keyFile *backup.KeyFile // 已读取的 keyfile
+}
+
+func (k *keyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&k.KeyHex, "key-hex", "", "Hex encoded AES-256 key used instead of the password, HMAC is not checked")
+	fs.StringVar(&k.KeyFile, "keyfile", "", "Keyfile written by export-keys, used instead of the password")
+	k.passphrase.register(fs)
+}
+
+// check 检查参数，--key-hex 和 --keyfile 只能使用一个
+func (k *keyFlags) check() error {
+	if k.KeyHex != "" && k.KeyFile != "" {
+		return usageErrorf("--key-hex and --keyfile cannot be used together")
+	}
+	if k.KeyHex != "" {
+		key, err := hex.DecodeString(k.KeyHex)
+		if err != nil || len(key) != internal.AesKeyLength {
+			return usageErrorf("--key-hex must be %d hex encoded bytes", internal.AesKeyLength)
+		}
+	}
+	return nil
+}
+
+// loadKeyFile 读取 --keyfile，结果会被缓存
+func (k *keyFlags) loadKeyFile() (*backup.KeyFile, error) {
+	if k.keyFile != nil {
+		return k.keyFile, nil
+	}
+	keyFile, err := backup.ReadKeyFile(k.KeyFile, k.passphrase.read)
+	if err != nil {
+		return nil, fmt.Errorf("read keyfile: %w", err)
+	}
+	k.keyFile = keyFile
+	return keyFile, nil
+}
+
+// moduleCrypto 解密一个模块需要的密钥
+type moduleCrypto struct {
+	key []byte
+	iv  []byte
+
+	// newHmac 返回校验分片的 hmac-sha256，没有 HMAC 密钥时返回 nil
+	newHmac func(item internal.CheckMsgV3Item) hash.Hash
+}
+
+// fileCrypto 返回解密单个文件的密钥，使用 keyfile 时按 encMsgV3 查找模块
+func (k *keyFlags) fileCrypto(g *Globals, encMsgV3 string) (*moduleCrypto, error) {
+	return k.crypto(g, encMsgV3, func(keyFile *backup.KeyFile) (*backup.ModuleKeys, error) {
+		moduleKeys := keyFile.ModuleByEncMsgV3(encMsgV3)
+		if moduleKeys == nil {
+			return nil, errors.New("encMsgV3 not found in keyfile")
+		}
+		return moduleKeys, nil
+	})
+}
+
+// moduleCrypto 返回解密备份中模块的密钥，使用 keyfile 时检查它属于这个备份
+func (k *keyFlags) moduleCrypto(g *Globals, b *backup.Backup, module infoxml.BackupFileModuleInfo) (*moduleCrypto, error) {
+	return k.crypto(g, module.EncMsgV3, func(keyFile *backup.KeyFile) (*backup.ModuleKeys, error) {
+		return b.ModuleKeys(keyFile, module)
+	})
+}
+
+func (k *keyFlags) crypto(g *Globals, encMsgV3Str string, lookup func(*backup.KeyFile) (*backup.ModuleKeys, error)) (*moduleCrypto, error) {
+	switch {
+	case k.KeyHex != "":
+		encMsgV3, err := internal.ParseEncMsgV3("", encMsgV3Str)
+		if err != nil {
+			return nil, fmt.Errorf("ParseEncMsgV3 Failed: %w", err)
+		}
+		key, _ := hex.DecodeString(k.KeyHex)
+		return &moduleCrypto{
+			key:     key,
+			iv:      encMsgV3.Iv,
+			newHmac: func(internal.CheckMsgV3Item) hash.Hash { return nil },
+		}, nil
+
+	case k.KeyFile != "":
+		keyFile, err := k.loadKeyFile()
+		if err != nil {
+			return nil, err
+		}
+		moduleKeys, err := lookup(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, iv, err := moduleKeys.Key()
+		if err != nil {
+			return nil, err
+		}
+		return &moduleCrypto{
+			key: key,
+			iv:  iv,
+			newHmac: func(item internal.CheckMsgV3Item) hash.Hash {
+				return moduleKeys.NewHmac(item.FileName)
+			},
+		}, nil
+	}
+
+	password, err := g.ReadPassword()
+	if err != nil {
+		return nil, err
+	}
+	encMsgV3, err := internal.ParseEncMsgV3(password, encMsgV3Str)
+	if err != nil {
+		return nil, fmt.Errorf("ParseEncMsgV3 Failed: %w", err)
+	}
+	slog.Debug("encMsgV3", "salt", logging.Secret(encMsgV3.Salt), "iv", logging.Secret(encMsgV3.Iv))
+	return &moduleCrypto{
+		// 32 bytes key is aes-256
+		key: encMsgV3.DeriveKey(password),
+		iv:  encMsgV3.Iv,
+		newHmac: func(item internal.CheckMsgV3Item) hash.Hash {
+			return item.NewHmac(password)
+		},
+	}, nil
+}
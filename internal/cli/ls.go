@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/archive"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+)
+
+var lsCommand = &Command{
+	Name:  "ls",
+	Short: "List the files inside the encrypted tars of a backup",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argModule := fs.String("module", "", "Only list the given package name (default: all modules)")
+		argPattern := fs.String("pattern", "", "Only list entries whose path matches this glob")
+		argIndexDir := fs.String("index-dir", "", "Directory of index files built by the index command (default: <input>/.kobackup-index)")
+		argSaveIndex := fs.Bool("save-index", false, "Save the index of chunks decrypted without one to --index-dir")
+		return func(g *Globals) error {
+			return runLs(g, *argInput, *argModule, *argPattern, *argIndexDir, *argSaveIndex)
+		}
+	},
+}
+
+// listItem 是 JSON 输出时每行的结构
+type listItem struct {
+	Module  string    `json:"module"`
+	Chunk   string    `json:"chunk"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+}
+
+func runLs(g *Globals, input string, moduleName string, pattern string, indexDir string, save bool) error {
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	modules, err := b.SelectModules(moduleName)
+	if err != nil {
+		return err
+	}
+
+	if indexDir == "" {
+		indexDir = b.DefaultIndexDir()
+	}
+
+	// 检查 pattern 是否合法
+	_, err = archive.Match(pattern, "")
+	if err != nil {
+		return usageErrorf("Invalid pattern: %v", err)
+	}
+
+	var emit func(item listItem) error
+	flush := func() error { return nil }
+	if g.JSON() {
+		enc := json.NewEncoder(os.Stdout)
+		emit = func(item listItem) error {
+			return enc.Encode(item)
+		}
+	} else {
+		tw := newTable(os.Stdout)
+		flush = tw.Flush
+		emit = func(item listItem) error {
+			_, err := fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n",
+				item.Mode, item.Size, item.ModTime.Format(time.DateTime), item.Module, item.Path)
+			return err
+		}
+	}
+	defer flush()
+
+	failed := false
+	for _, module := range modules {
+		key, iv, err := backup.ModuleKey(password, module)
+		if err != nil {
+			slog.Error(err.Error())
+			failed = true
+			continue
+		}
+
+		chunks, err := b.ChunkFiles(module.Name)
+		if err != nil {
+			slog.Error("failed to find chunks", "module", module.Name, "err", err)
+			failed = true
+			continue
+		}
+
+		// 没有 checkMsgV3 时无法使用索引，直接解密
+		items, err := backup.ChunkItems(module)
+		if err != nil {
+			slog.Warn("invalid checkMsgV3, not using index", "module", module.Name, "err", err)
+		}
+
+		for _, chunk := range chunks {
+			index, err := loadIndex(indexDir, save, items, chunk, key, iv, password)
+			if err == nil {
+				err = listIndex(index, func(entry archive.Entry) error {
+					match, _ := archive.Match(pattern, entry.Name)
+					if !match {
+						return nil
+					}
+					return emit(listItem{
+						Module:  module.Name,
+						Chunk:   filepath.Base(chunk),
+						Path:    entry.Name,
+						Size:    entry.Size,
+						Mode:    entry.Mode.String(),
+						ModTime: entry.ModTime,
+					})
+				})
+			}
+			if err != nil {
+				slog.Error("failed to list", "chunk", chunk, "err", err)
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// loadIndex 返回分片的索引
+//
+// 没有有效的索引时流式解密分片，GCM tag 和 checkMsgV3 HMAC 都校验通过后返回新的索引。
+// 索引包含明文的文件名，只有 save 为 true 时才保存到 indexDir
+func loadIndex(indexDir string, save bool, items map[string]internal.CheckMsgV3Item, chunk string, key []byte, iv []byte, password string) (*archive.Index, error) {
+	item := chunkItem(items, chunk)
+	if index := validIndex(indexDir, item, chunk); index != nil {
+		return index, nil
+	}
+
+	index, err := backup.ScanChunk(chunk, key, iv, item, password, nil)
+	if err != nil {
+		return nil, err
+	}
+	if save {
+		saveIndex(indexDir, index, chunk)
+	}
+	return index, nil
+}
+
+// listIndex 按索引遍历分片中的 tar 条目
+func listIndex(index *archive.Index, fn func(archive.Entry) error) error {
+	for _, entry := range index.Entries {
+		err := fn(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
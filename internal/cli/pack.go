@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+)
+
+var packCommand = &Command{
+	Name:  "pack",
+	Short: "Encrypt a directory of plain app data tars into a backup HiSuite can restore",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input directory laid out like the decrypt-dir output")
+		argOutput := fs.String("output", "", "Output backup directory, must not exist (default: <input>_packed)")
+		return func(g *Globals) error {
+			if *argInput == "" {
+				return usageErrorf("--input is required")
+			}
+			return runPack(g, *argInput, *argOutput)
+		}
+	},
+}
+
+func runPack(g *Globals, input string, output string) error {
+	if output == "" {
+		output = filepath.Clean(input) + "_packed"
+	}
+
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+
+	err = backup.Pack(input, output, password, func(rel string) {
+		slog.Info("encrypting", "file", rel)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to pack backup: %w", err)
+	}
+
+	slog.Info("backup packed", "output", output)
+	return nil
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// PasswordEnv 保存备份密码的环境变量
+const PasswordEnv = "KOBACKUP_PASSWORD"
+
+// maxPasswordSize 从文件、fd 或命令读取密码或 passphrase 时的大小上限
+const maxPasswordSize = 64 * 1024
+
+// ReadPassword 返回备份密码，结果会被缓存
+//
+// 按以下顺序选择来源，显式指定的来源只能有一个：
+// --password、--password-file、--password-fd、--password-command、
+// 环境变量 KOBACKUP_PASSWORD，最后在终端上不回显地提示输入
+func (g *Globals) ReadPassword() (string, error) {
+	if g.password != nil {
+		return *g.password, nil
+	}
+
+	password, err := g.readPassword()
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("password is empty")
+	}
+	g.password = &password
+	return password, nil
+}
+
+func (g *Globals) readPassword() (string, error) {
+	return secretSource{
+		name:    "password",
+		env:     PasswordEnv,
+		Value:   g.Password,
+		File:    g.PasswordFile,
+		Fd:      g.PasswordFd,
+		Command: g.PasswordCommand,
+	}.read()
+}
+
+// passwordGiven 是否通过参数显式指定了密码来源，不包括环境变量
+func (g *Globals) passwordGiven() bool {
+	return g.Password != "" || g.PasswordFile != "" || g.PasswordFd >= 0 || g.PasswordCommand != ""
+}
+
+// secretSource 密码一类秘密值的来源，对应 --<name>、--<name>-file、--<name>-fd、--<name>-command 参数
+type secretSource struct {
+	name    string // 参数名，也用于错误信息
+	env     string // 保存秘密值的环境变量
+	Value   string
+	File    string
+	Fd      int // -1 表示不使用
+	Command string
+}
+
+// read 读取秘密值，显式指定的来源只能有一个，都没有指定时依次使用环境变量和终端提示
+func (s secretSource) read() (string, error) {
+	var sources []string
+	if s.Value != "" {
+		sources = append(sources, "--"+s.name)
+	}
+	if s.File != "" {
+		sources = append(sources, "--"+s.name+"-file")
+	}
+	if s.Fd >= 0 {
+		sources = append(sources, "--"+s.name+"-fd")
+	}
+	if s.Command != "" {
+		sources = append(sources, "--"+s.name+"-command")
+	}
+	if len(sources) > 1 {
+		return "", fmt.Errorf("only one %s source can be used, got %s", s.name, strings.Join(sources, ", "))
+	}
+
+	switch {
+	case s.Value != "":
+		return s.Value, nil
+
+	case s.File != "":
+		file, err := os.Open(s.File)
+		if err != nil {
+			return "", fmt.Errorf("read %s file: %w", s.name, err)
+		}
+		defer file.Close()
+		secret, err := readSecret(file)
+		if err != nil {
+			return "", fmt.Errorf("read %s file: %w", s.name, err)
+		}
+		return secret, nil
+
+	case s.Fd >= 0:
+		file := os.NewFile(uintptr(s.Fd), s.name+"-fd")
+		if file == nil {
+			return "", fmt.Errorf("invalid %s fd %d", s.name, s.Fd)
+		}
+		defer file.Close()
+		secret, err := readSecret(file)
+		if err != nil {
+			return "", fmt.Errorf("read %s fd %d: %w", s.name, s.Fd, err)
+		}
+		return secret, nil
+
+	case s.Command != "":
+		secret, err := runPasswordCommand(s.Command)
+		if err != nil {
+			return "", fmt.Errorf("%s command: %w", s.name, err)
+		}
+		return secret, nil
+	}
+
+	if secret, ok := os.LookupEnv(s.env); ok {
+		return secret, nil
+	}
+
+	// 没有指定来源时在终端上提示输入
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no %s given: use --%s-file, --%s-fd, --%s-command or %s", s.name, s.name, s.name, s.name, s.env)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt(s.name))
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", s.name, err)
+	}
+	return string(secret), nil
+}
+
+// prompt 把参数名转为终端提示，例如 keyfile-passphrase 转为 Keyfile passphrase
+func prompt(name string) string {
+	name = strings.ReplaceAll(name, "-", " ")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// readSecret 读取秘密值，去掉末尾的一个换行符
+func readSecret(r io.Reader) (string, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxPasswordSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > maxPasswordSize {
+		return "", fmt.Errorf("longer than %d bytes", maxPasswordSize)
+	}
+	content = bytes.TrimSuffix(content, []byte("\n"))
+	content = bytes.TrimSuffix(content, []byte("\r"))
+	return string(content), nil
+}
+
+// runPasswordCommand 通过 shell 运行命令，标准输出的内容作为秘密值
+//
+// 标准输入和标准错误继承自当前进程，命令可以自己提示输入
+func runPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return "", fmt.Errorf("run: %w", err)
+	}
+	password, readErr := readSecret(out)
+	// 读取失败时也要等待命令退出
+	io.Copy(io.Discard, out)
+	err = cmd.Wait()
+	if err != nil {
+		return "", fmt.Errorf("run: %w", err)
+	}
+	if readErr != nil {
+		return "", fmt.Errorf("read output: %w", readErr)
+	}
+	return password, nil
+}
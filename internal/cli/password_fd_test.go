@@ -0,0 +1,32 @@
+//go:build unix
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+// TestReadPasswordFd 检查从 --password-fd 读取密码
+//
+// ReadPassword 会关闭这个 fd，所以使用没有 *os.File 持有的原始 fd，
+// 避免 *os.File 的 finalizer 再次关闭同一个编号，关掉其他测试打开的文件
+func TestReadPasswordFd(t *testing.T) {
+	var fds [2]int
+	err := syscall.Pipe(fds[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := os.NewFile(uintptr(fds[1]), "password-pipe")
+	go func() {
+		w.WriteString("from fd\n")
+		w.Close()
+	}()
+
+	g := Globals{PasswordFd: fds[0]}
+	got, err := g.ReadPassword()
+	if err != nil || got != "from fd" {
+		t.Errorf("ReadPassword() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestReadPassword 检查各种密码来源，以及同时指定多个来源时报错
+func TestReadPassword(t *testing.T) {
+	t.Setenv(PasswordEnv, "from env")
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	err := os.WriteFile(passwordFile, []byte("from file\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type passwordTest struct {
+		name    string
+		g       Globals
+		want    string
+		wantErr bool
+	}
+	tests := []passwordTest{
+		{"flag", Globals{Password: "from flag", PasswordFd: -1}, "from flag", false},
+		{"file", Globals{PasswordFile: passwordFile, PasswordFd: -1}, "from file", false},
+		{"env", Globals{PasswordFd: -1}, "from env", false},
+		{"conflict", Globals{Password: "a", PasswordFile: passwordFile, PasswordFd: -1}, "", true},
+		{"missing file", Globals{PasswordFile: passwordFile + ".missing", PasswordFd: -1}, "", true},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests,
+			passwordTest{"command", Globals{PasswordCommand: "printf 'from command\\n'", PasswordFd: -1}, "from command", false},
+			passwordTest{"failed command", Globals{PasswordCommand: "exit 3", PasswordFd: -1}, "", true},
+		)
+	}
+
+	for _, tt := range tests {
+		got, err := tt.g.ReadPassword()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: ReadPassword() = %q, %v", tt.name, got, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+)
+
+// NewPasswordEnv 保存 repassword 新密码的环境变量
+const NewPasswordEnv = "KOBACKUP_NEW_PASSWORD"
+
+var repasswordCommand = &Command{
+	Name:  "repassword",
+	Short: "Re-encrypt a backup with a new password into a new directory",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argOutput := fs.String("output", "", "Output directory, must not exist (default: <input>_repassword)")
+		newPassword := secretSource{name: "new-password", env: NewPasswordEnv}
+		fs.StringVar(&newPassword.Value, "new-password", "", "New backup password (visible in ps and shell history)")
+		fs.StringVar(&newPassword.File, "new-password-file", "", "Read the new password from this file")
+		fs.IntVar(&newPassword.Fd, "new-password-fd", -1, "Read the new password from this file descriptor")
+		fs.StringVar(&newPassword.Command, "new-password-command", "", "Run this shell command and use its stdout as the new password")
+		return func(g *Globals) error {
+			if *argInput == "" {
+				return usageErrorf("--input is required")
+			}
+			return runRepassword(g, *argInput, *argOutput, newPassword)
+		}
+	},
+}
+
+func runRepassword(g *Globals, input string, output string, newPasswordSource secretSource) error {
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	if output == "" {
+		output = filepath.Clean(input) + "_repassword"
+	}
+
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+	newPassword, err := newPasswordSource.read()
+	if err != nil {
+		return err
+	}
+	if newPassword == "" {
+		return errors.New("new password is empty")
+	}
+	if newPassword == password {
+		slog.Warn("the new password is the same as the old one, only salts and IVs change")
+	}
+
+	err = b.Repassword(password, newPassword, output, func(rel string) {
+		slog.Info("re-encrypting", "file", rel)
+	})
+	if errors.Is(err, backup.ErrWrongPassword) {
+		return errors.New("the password does not match the backup")
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to re-encrypt backup: %w", err)
+	}
+
+	slog.Info("backup re-encrypted", "output", output)
+	return nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+)
+
+var sanitizeCommand = &Command{
+	Name:  "sanitize",
+	Short: "Turn a backup into a shareable test case with placeholder identifiers and dummy data",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argOutput := fs.String("output", "", "Output directory, must not exist (default: <input>_sanitized)")
+		argNewPassword := fs.String("new-password", fixture.Password, "Throwaway password the sanitized backup is encrypted with")
+		return func(g *Globals) error {
+			if *argInput == "" {
+				return usageErrorf("--input is required")
+			}
+			if *argNewPassword == "" {
+				return usageErrorf("--new-password must not be empty")
+			}
+			return runSanitize(g, *argInput, *argOutput, *argNewPassword)
+		}
+	},
+}
+
+// runSanitize 不需要原来的密码，原来的内容不会被读取
+func runSanitize(g *Globals, input string, output string, newPassword string) error {
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	if output == "" {
+		output = filepath.Clean(input) + "_sanitized"
+	}
+
+	err = b.Sanitize(output, newPassword, func(rel string) {
+		slog.Info("replacing", "file", rel)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to sanitize backup: %w", err)
+	}
+
+	slog.Info("backup sanitized, check info.xml and backupinfo.ini before sharing", "output", output)
+	return nil
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+)
+
+var tryPasswordsCommand = &Command{
+	Name:  "try-passwords",
+	Short: "Test candidate passwords offline against the checkMsgV3 HMAC of a backup",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input backup directory path")
+		argCandidates := fs.String("candidates", "-", "File with one candidate password per line, - for stdin")
+		argJobs := fs.Int("jobs", 0, "Number of candidates tested in parallel (default: number of CPUs)")
+		return func(g *Globals) error {
+			return runTryPasswords(g, *argInput, *argCandidates, *argJobs)
+		}
+	},
+}
+
+// tryPasswordsResult try-passwords 的 JSON 输出
+type tryPasswordsResult struct {
+	Found    bool   `json:"found"`
+	Password string `json:"password,omitempty"`
+	Module   string `json:"module"` // 用来测试的分片所属的模块
+	Chunk    string `json:"chunk"`
+	Tried    int    `json:"tried"` // 候选密码的数量
+}
+
+func runTryPasswords(g *Globals, input string, candidatesPath string, jobs int) error {
+	b, err := backup.Open(input)
+	if err != nil {
+		return fmt.Errorf("Failed to open backup: %w", err)
+	}
+	candidates, err := readCandidates(candidatesPath)
+	if err != nil {
+		return err
+	}
+
+	password, found, checker, err := findPassword(b, candidates, jobs)
+	if err != nil {
+		return err
+	}
+
+	if g.JSON() {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(tryPasswordsResult{
+			Found:    found,
+			Password: password,
+			Module:   checker.Module,
+			Chunk:    checker.Path,
+			Tried:    len(candidates),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to encode result: %w", err)
+		}
+	} else if found {
+		// 只把密码输出到标准输出，方便脚本使用
+		fmt.Println(password)
+	}
+
+	if !found {
+		slog.Error("no candidate matched", "tried", len(candidates))
+		return errFailed
+	}
+	return nil
+}
+
+// findPassword 在备份最小的分片上测试候选密码
+func findPassword(b *backup.Backup, candidates []string, jobs int) (string, bool, *backup.PasswordChecker, error) {
+	checker, err := b.NewPasswordChecker()
+	if err != nil {
+		return "", false, nil, err
+	}
+	defer checker.Close()
+
+	slog.Info("testing candidates", "count", len(candidates), "module", checker.Module, "chunk", checker.Path, "size", checker.Size)
+	start := time.Now()
+	password, found, err := checker.Find(candidates, jobs)
+	if err != nil {
+		return "", false, nil, fmt.Errorf("read %s: %w", checker.Path, err)
+	}
+	slog.Info("candidates tested", "found", found, "elapsed", time.Since(start).Round(time.Millisecond))
+	return password, found, checker, nil
+}
+
+// readCandidates 读取候选密码，每行一个，path 为 - 时读取标准输入
+//
+// 去掉行尾的 \r，跳过空行和重复的密码
+func readCandidates(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("read candidates: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		candidates = append(candidates, line)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("read candidates: %w", err)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates in %s", path)
+	}
+	return candidates, nil
+}
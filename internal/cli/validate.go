@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+var validateCommand = &Command{
+	Name:  "validate",
+	Short: "Validate info.xml against the schema of its backupVersion",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argInput := fs.String("input", "", "Input info.xml path or backup directory path")
+		return func(g *Globals) error {
+			return runValidate(g, *argInput)
+		}
+	},
+}
+
+func runValidate(g *Globals, input string) error {
+	// 传入目录时使用其中的 info.xml
+	infoXmlPath := input
+	fileInfo, err := os.Stat(infoXmlPath)
+	if err != nil {
+		return fmt.Errorf("Failed to stat input path: %w", err)
+	}
+	if fileInfo.IsDir() {
+		infoXmlPath = filepath.Join(infoXmlPath, "info.xml")
+	}
+
+	infoXml, err := infoxml.Parse(infoXmlPath)
+	if err != nil {
+		return fmt.Errorf("Failed to parse info.xml: %w", err)
+	}
+
+	issues := infoxml.Validate(infoXml)
+
+	if g.JSON() {
+		if issues == nil {
+			issues = []infoxml.Issue{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(issues)
+		if err != nil {
+			return fmt.Errorf("Failed to encode issues: %w", err)
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	}
+
+	if infoxml.HasErrors(issues) {
+		return errFailed
+	}
+	if !g.JSON() {
+		slog.Info("no errors found", "warnings", len(issues))
+	}
+	return nil
+}
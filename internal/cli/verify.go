@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/logging"
+)
+
+var verifyCommand = &Command{
+	Name:  "verify",
+	Short: "Verify the checkMsgV3 HMAC of an encrypted file",
+	Setup: func(fs *flag.FlagSet) func(g *Globals) error {
+		argCheckMsgV3 := fs.String("checkMsgV3", "", "CheckMsgV3 string containing expected HMAC, salt and filename info")
+		argInput := fs.String("input", "", "Input file path to verify hash")
+		return func(g *Globals) error {
+			return runVerify(g, *argCheckMsgV3, *argInput)
+		}
+	},
+}
+
+func runVerify(g *Globals, checkMsgV3 string, input string) error {
+	password, err := g.ReadPassword()
+	if err != nil {
+		return err
+	}
+
+	checkMsgV3Item, err := findCheckMsgV3Item(checkMsgV3, input)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("checkMsgV3 item", "file", checkMsgV3Item.FileName,
+		"expectedHmac", fmt.Sprintf("%X", checkMsgV3Item.ExpectedHmac), "salt", logging.Secret(checkMsgV3Item.Salt))
+
+	inputFile, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("Input File can't open: %w", err)
+	}
+	defer inputFile.Close()
+
+	hmacHash := checkMsgV3Item.NewHmac(password)
+	_, err = io.Copy(hmacHash, inputFile)
+	if err != nil {
+		return fmt.Errorf("hmacFile Failed: %w", err)
+	}
+	fileHash := hmacHash.Sum(nil)
+
+	if !checkMsgV3Item.Verify(fileHash) {
+		slog.Error("checkMsgV3 hash mismatch", "file", input, "hmac", fmt.Sprintf("%X", fileHash))
+		return errFailed
+	}
+
+	slog.Info("checkMsgV3 OK", "file", input)
+	return nil
+}
+
+// findCheckMsgV3Item 在 checkMsgV3 中查找输入文件对应的项
+func findCheckMsgV3Item(checkMsgV3 string, input string) (*internal.CheckMsgV3Item, error) {
+	// 其他项无效时不影响输入文件的项
+	items, err := internal.ParseCheckMsgV3Mode(checkMsgV3, internal.CheckMsgV3Tolerant)
+	var itemsErr *internal.CheckMsgV3Error
+	if err != nil && !errors.As(err, &itemsErr) {
+		return nil, fmt.Errorf("ParseCheckMsgV3 Failed: %w", err)
+	}
+	for _, item := range items {
+		if item.FileName == filepath.Base(input) {
+			return &item, nil
+		}
+	}
+	if itemsErr != nil {
+		return nil, fmt.Errorf("%s not found in checkMsgV3: %w", filepath.Base(input), itemsErr)
+	}
+	return nil, fmt.Errorf("%s not found in checkMsgV3", filepath.Base(input))
+}
@@ -0,0 +1,357 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// Kind 问题的类型
+type Kind string
+
+const (
+	KindMetadata       Kind = "metadata"         // backupinfo.ini 和 info.xml 不一致
+	KindMissingModule  Kind = "missing-module"   // 模块在磁盘上没有任何文件
+	KindMissingFile    Kind = "missing-file"     // checkMsgV3 或 apk_size 引用的文件不存在
+	KindOrphanFile     Kind = "orphan-file"      // 文件不属于任何模块
+	KindSizeMismatch   Kind = "size-mismatch"    // apk_size、db_size 与文件大小不一致
+	KindSelectDataSize Kind = "select-data-size" // selectDataSize 与应用大小之和不一致
+)
+
+// Finding 表示检查发现的一个问题
+type Finding struct {
+	Severity infoxml.Severity `json:"severity"`
+	Kind     Kind             `json:"kind"`
+	Module   string           `json:"module,omitempty"`
+	Path     string           `json:"path,omitempty"` // 相对备份目录的路径
+	Message  string           `json:"message"`
+}
+
+func (f Finding) String() string {
+	location := f.Module
+	if f.Path != "" {
+		location = f.Path
+	}
+	if location == "" {
+		return fmt.Sprintf("%s: %s: %s", f.Severity, f.Kind, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", f.Severity, f.Kind, location, f.Message)
+}
+
+// HasErrors 判断是否有 error 级别的问题
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == infoxml.SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataFiles 备份目录下不属于任何模块的已知文件
+var metadataFiles = []string{"info.xml", "backupinfo.ini", backup.IndexDirName}
+
+// checker 保存一次检查的状态
+type checker struct {
+	b        *backup.Backup
+	info     *backupinfo.BackupInfo
+	findings []Finding
+
+	entries map[string]fs.FileInfo // 备份目录下的顶层文件和目录
+	owners  map[string]string      // 顶层条目名对应的模块名
+}
+
+func (c *checker) add(severity infoxml.Severity, kind Kind, module string, path string, format string, args ...any) {
+	c.findings = append(c.findings, Finding{
+		Severity: severity,
+		Kind:     kind,
+		Module:   module,
+		Path:     filepath.ToSlash(path),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Check 对比 backupinfo.ini、info.xml 中的模块和磁盘上的文件
+//
+// info 为 nil 时只检查 info.xml 和磁盘上的文件。
+// 顶层文件按包名前缀归属到模块，例如 <pkg>.apk、<pkg>.tar、<pkg>_appDataTar；
+// db_size 与 <pkg>.db、<pkg>.tar 和 <pkg>_appDataTar 下分片的大小之和比较
+func Check(b *backup.Backup, info *backupinfo.BackupInfo) ([]Finding, error) {
+	c := &checker{b: b, info: info}
+	err := c.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	c.checkMetadata()
+	c.checkModules()
+	c.checkOrphans()
+	c.checkApps()
+	c.checkSelectDataSize()
+
+	return c.findings, nil
+}
+
+// moduleNames 返回 info.xml 和 backupinfo.ini 中出现的所有模块名
+func (c *checker) moduleNames() []string {
+	var names []string
+	for _, module := range c.b.Modules {
+		names = append(names, module.Name)
+	}
+	if c.info != nil {
+		names = append(names, c.info.PackageNames...)
+		for _, app := range c.info.Apps {
+			names = append(names, app.PackageName)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// scan 读取备份目录的顶层条目，并按最长的包名前缀归属到模块
+func (c *checker) scan() error {
+	dirEntries, err := os.ReadDir(c.b.Dir)
+	if err != nil {
+		return err
+	}
+
+	names := c.moduleNames()
+	c.entries = map[string]fs.FileInfo{}
+	c.owners = map[string]string{}
+	for _, dirEntry := range dirEntries {
+		fileInfo, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		c.entries[dirEntry.Name()] = fileInfo
+
+		owner := ""
+		for _, name := range names {
+			if name == "" || len(name) <= len(owner) {
+				continue
+			}
+			entryName := dirEntry.Name()
+			if entryName == name || strings.HasPrefix(entryName, name+".") || strings.HasPrefix(entryName, name+"_") {
+				owner = name
+			}
+		}
+		if owner != "" {
+			c.owners[dirEntry.Name()] = owner
+		}
+	}
+	return nil
+}
+
+// fileSize 返回顶层文件的大小，不存在或者是目录时返回 false
+func (c *checker) fileSize(name string) (int64, bool) {
+	fileInfo, ok := c.entries[name]
+	if !ok || fileInfo.IsDir() {
+		return 0, false
+	}
+	return fileInfo.Size(), true
+}
+
+// chunks 返回模块的分片文件，文件名对应大小
+func (c *checker) chunks(name string) (map[string]int64, error) {
+	paths, err := c.b.ChunkFiles(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[string]int64, len(paths))
+	for _, path := range paths {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		chunks[filepath.Base(path)] = fileInfo.Size()
+	}
+	return chunks, nil
+}
+
+// checkMetadata 对比 app_info、[pkg] 节和 BackupFileModuleInfo
+func (c *checker) checkMetadata() {
+	if c.info == nil {
+		return
+	}
+
+	for _, name := range c.info.PackageNames {
+		if c.info.App(name) == nil {
+			c.add(infoxml.SeverityWarning, KindMetadata, name, "", "listed in app_info but backupinfo.ini has no [%s] section", name)
+		}
+		if _, err := c.b.Module(name); err != nil {
+			c.add(infoxml.SeverityError, KindMetadata, name, "", "listed in app_info but missing from BackupFileModuleInfo")
+		}
+	}
+	for _, app := range c.info.Apps {
+		if !slices.Contains(c.info.PackageNames, app.PackageName) {
+			c.add(infoxml.SeverityWarning, KindMetadata, app.PackageName, "", "backupinfo.ini has a [%s] section but app_info does not list it", app.PackageName)
+		}
+	}
+
+	// 只有应用模块有 apk 或 _appDataTar，其他模块（联系人、短信等）不在 app_info 中
+	for _, module := range c.b.Modules {
+		if slices.Contains(c.info.PackageNames, module.Name) {
+			continue
+		}
+		_, hasApk := c.entries[module.Name+".apk"]
+		_, hasData := c.entries[module.Name+"_appDataTar"]
+		if hasApk || hasData {
+			c.add(infoxml.SeverityWarning, KindMetadata, module.Name, "", "app module is not listed in backupinfo.ini app_info")
+		}
+	}
+}
+
+// checkModules 检查模块在磁盘上的文件和 checkMsgV3 中的分片
+func (c *checker) checkModules() {
+	names := c.moduleNames()
+	owned := map[string]bool{}
+	for _, owner := range c.owners {
+		owned[owner] = true
+	}
+	for _, name := range names {
+		if !owned[name] {
+			c.add(infoxml.SeverityError, KindMissingModule, name, "", "no files on disk")
+		}
+	}
+
+	for _, module := range c.b.Modules {
+		chunks, err := c.chunks(module.Name)
+		if err != nil {
+			c.add(infoxml.SeverityError, KindMissingFile, module.Name, "", "%v", err)
+			continue
+		}
+
+		var items []internal.CheckMsgV3Item
+		if module.CheckMsgV3 != "" {
+			items, err = internal.ParseCheckMsgV3Mode(module.CheckMsgV3, internal.CheckMsgV3Tolerant)
+			var itemsErr *internal.CheckMsgV3Error
+			switch {
+			case errors.As(err, &itemsErr):
+				// 无效的项逐个报告，其余项照常检查
+				for _, itemErr := range itemsErr.Items {
+					c.add(infoxml.SeverityError, KindMetadata, module.Name, "", "%v", itemErr)
+				}
+			case err != nil:
+				c.add(infoxml.SeverityError, KindMetadata, module.Name, "", "checkMsgV3: %v", err)
+				continue
+			}
+		}
+
+		listed := map[string]bool{}
+		for _, item := range items {
+			listed[item.FileName] = true
+			_, inChunks := chunks[item.FileName]
+			_, inDir := c.fileSize(item.FileName)
+			if !inChunks && !inDir {
+				c.add(infoxml.SeverityError, KindMissingFile, module.Name, filepath.Join(module.Name+"_appDataTar", item.FileName), "listed in checkMsgV3 but the file does not exist")
+			}
+		}
+
+		dir := module.Name + "_appDataTar"
+		for _, chunk := range sortedKeys(chunks) {
+			if !listed[chunk] {
+				c.add(infoxml.SeverityWarning, KindOrphanFile, module.Name, filepath.Join(dir, chunk), "chunk has no checkMsgV3 entry")
+			}
+		}
+	}
+}
+
+// checkOrphans 报告不属于任何模块的顶层文件
+func (c *checker) checkOrphans() {
+	for _, name := range sortedKeys(c.entries) {
+		if c.owners[name] != "" || slices.Contains(metadataFiles, name) {
+			continue
+		}
+		c.add(infoxml.SeverityWarning, KindOrphanFile, "", name, "file does not belong to any module")
+	}
+}
+
+// checkApps 对比 apk_size、db_size 和文件大小
+func (c *checker) checkApps() {
+	if c.info == nil {
+		return
+	}
+
+	for _, app := range c.info.Apps {
+		apkName := app.PackageName + ".apk"
+		apkSize, ok := c.fileSize(apkName)
+		switch {
+		case !ok && app.ApkSize > 0:
+			c.add(infoxml.SeverityError, KindMissingFile, app.PackageName, apkName, "apk_size is %d but the file does not exist", app.ApkSize)
+		case ok && apkSize != app.ApkSize:
+			c.add(infoxml.SeverityError, KindSizeMismatch, app.PackageName, apkName, "apk_size is %d but the file is %d bytes", app.ApkSize, apkSize)
+		}
+
+		if app.DbSize == 0 {
+			continue
+		}
+		dataSize := int64(0)
+		for _, name := range []string{app.PackageName + ".db", app.PackageName + ".tar"} {
+			size, _ := c.fileSize(name)
+			dataSize += size
+		}
+		chunks, err := c.chunks(app.PackageName)
+		if err != nil {
+			continue
+		}
+		for _, size := range chunks {
+			dataSize += size
+		}
+		if dataSize != app.DbSize {
+			c.add(infoxml.SeverityWarning, KindSizeMismatch, app.PackageName, "", "db_size is %d but the data files are %d bytes", app.DbSize, dataSize)
+		}
+	}
+}
+
+// checkSelectDataSize 对比 selectDataSize 和 apk_size、db_size 之和
+//
+// selectDataSize 还包括联系人、短信等非应用模块，所以只有全部模块都是应用时才要求相等
+func (c *checker) checkSelectDataSize() {
+	if c.info == nil {
+		return
+	}
+	header, err := c.b.InfoXml.GetHeaderInfo()
+	if err != nil || header.SelectDataSize == 0 {
+		return
+	}
+
+	total := int64(0)
+	for _, app := range c.info.Apps {
+		total += app.ApkSize + app.DbSize
+	}
+
+	allApps := true
+	for _, module := range c.b.Modules {
+		if c.info.App(module.Name) == nil {
+			allApps = false
+			break
+		}
+	}
+
+	if total > header.SelectDataSize || (allApps && total != header.SelectDataSize) {
+		c.add(infoxml.SeverityWarning, KindSelectDataSize, "", "", "selectDataSize is %d but apk_size and db_size add up to %d", header.SelectDataSize, total)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
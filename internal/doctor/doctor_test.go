@@ -0,0 +1,94 @@
+package doctor_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/doctor"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, make([]byte, size), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheck 构造一个元数据和文件不一致的备份目录，检查每类问题都被报告
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	hmacSalt := strings.Repeat("ab", 64)
+
+	infoXml := &infoxml.InfoXml{}
+	infoXml.AddRow("HeaderInfo").SetColumnValue("selectDataSize", infoxml.LongValue(30))
+	app := infoXml.AddRow("BackupFileModuleInfo")
+	app.SetColumnValue("name", infoxml.StringValue("com.a"))
+	app.SetColumnValue("checkMsgV3", infoxml.StringValue(hmacSalt+"_a0.tar**"+hmacSalt+"_a1.tar"))
+	infoXml.AddRow("BackupFileModuleInfo").SetColumnValue("name", infoxml.StringValue("contact"))
+	infoXml.AddRow("BackupFileModuleInfo").SetColumnValue("name", infoxml.StringValue("com.c"))
+	err := infoXml.WriteFile(filepath.Join(dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupInfo, err := backupinfo.ParseString("[overview]\r\napp_info=com.a,com.b\r\n" +
+		"[com.a]\r\napk_size=10\r\ndb_size=20\r\n" +
+		"[com.b]\r\napk_size=5\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "com.a.apk"), 11)
+	writeFile(t, filepath.Join(dir, "com.a_appDataTar", "a0.tar"), 20)
+	writeFile(t, filepath.Join(dir, "com.a_appDataTar", "extra.tar"), 1)
+	writeFile(t, filepath.Join(dir, "contact.db"), 1)
+	writeFile(t, filepath.Join(dir, "stray.txt"), 1)
+
+	b, err := backup.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := doctor.Check(b, backupInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.String())
+	}
+	want := []string{
+		"error: metadata: com.b: listed in app_info but missing from BackupFileModuleInfo",
+		"error: missing-module: com.b: no files on disk",
+		"error: missing-module: com.c: no files on disk",
+		"error: missing-file: com.a_appDataTar/a1.tar: listed in checkMsgV3 but the file does not exist",
+		"warning: orphan-file: com.a_appDataTar/extra.tar: chunk has no checkMsgV3 entry",
+		"warning: orphan-file: stray.txt: file does not belong to any module",
+		"error: size-mismatch: com.a.apk: apk_size is 10 but the file is 11 bytes",
+		"warning: size-mismatch: com.a: db_size is 20 but the data files are 21 bytes",
+		"error: missing-file: com.b.apk: apk_size is 5 but the file does not exist",
+		"warning: select-data-size: selectDataSize is 30 but apk_size and db_size add up to 35",
+	}
+	for _, w := range want {
+		if !slices.Contains(got, w) {
+			t.Errorf("missing finding %q", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("findings = %q", got)
+	}
+	if !doctor.HasErrors(findings) {
+		t.Error("HasErrors = false")
+	}
+}
@@ -0,0 +1,236 @@
+package fixture
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+)
+
+// Password 生成的备份默认使用的密码
+const Password = "12345678"
+
+// DateTime 生成的备份的时间，固定的值便于比较输出
+var DateTime = time.Date(2024, 10, 10, 0, 33, 49, 0, time.UTC)
+
+// Module 一个应用模块
+type Module struct {
+	Name        string // 包名
+	AppName     string
+	VersionName string
+	VersionCode int
+	Chunks      int  // _appDataTar 下的分片数量
+	Files       int  // 每个分片中的文件数量
+	Apk         bool // 是否生成 <包名>.apk
+}
+
+// DefaultModules 默认生成的模块
+var DefaultModules = []Module{
+	{Name: "com.tencent.mm", AppName: "WeChat", VersionName: "8.0.50", VersionCode: 2800, Chunks: 3, Files: 4, Apk: true},
+	{Name: "com.android.chrome", AppName: "Chrome", VersionName: "129.0.6668.100", VersionCode: 666810000, Chunks: 2, Files: 3, Apk: true},
+	{Name: "com.example.notes", AppName: "Notes", VersionName: "1.0", VersionCode: 1, Chunks: 1, Files: 2},
+}
+
+// Options 生成选项，零值使用默认密码和 DefaultModules
+type Options struct {
+	Password string
+	Modules  []Module
+}
+
+// Fixture 生成的备份
+type Fixture struct {
+	Dir      string
+	Password string
+	Modules  []Module
+
+	// Chunks 每个分片的明文 tar，键为相对于 Dir 的路径（使用 /）
+	Chunks map[string][]byte
+	// Entries 每个分片中文件的内容，键为分片路径，值的键为 tar 中的路径
+	Entries map[string]map[string][]byte
+}
+
+// Generate 在不存在的目录 dir 中生成一个加密的 Kobackup 备份
+//
+// 包括多个模块、每个模块多个 tar 分片、encMsgV3 和 checkMsgV3、完整的 info.xml
+// 以及 UTF-16LE 编码的 backupinfo.ini；分片内容是确定的，salt 和 IV 是随机的
+func Generate(dir string, opts Options) (*Fixture, error) {
+	if opts.Password == "" {
+		opts.Password = Password
+	}
+	if opts.Modules == nil {
+		opts.Modules = DefaultModules
+	}
+	if len(opts.Modules) == 0 {
+		return nil, errors.New("no modules")
+	}
+
+	f := &Fixture{
+		Dir:      dir,
+		Password: opts.Password,
+		Modules:  opts.Modules,
+		Chunks:   map[string][]byte{},
+		Entries:  map[string]map[string][]byte{},
+	}
+
+	// 先生成明文目录，再用 backup.Pack 加密
+	staging, err := os.MkdirTemp("", "kobackup-fixture-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	for _, module := range opts.Modules {
+		err := f.writeModule(staging, module)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = newInfoXml(opts.Modules).WriteFile(filepath.Join(staging, "info.xml"))
+	if err != nil {
+		return nil, err
+	}
+	err = newBackupInfo(opts.Modules).WriteFile(filepath.Join(staging, "backupinfo.ini"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = backup.Pack(staging, dir, opts.Password, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Fixture) writeModule(staging string, module Module) error {
+	chunkDir := filepath.Join(staging, module.Name+"_appDataTar")
+	err := os.MkdirAll(chunkDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for i := range module.Chunks {
+		entries := map[string][]byte{}
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for j := range module.Files {
+			name := fmt.Sprintf("data/data/%s/files/chunk%d/file%d.txt", module.Name, i, j)
+			content := bytes.Repeat([]byte(fmt.Sprintf("%s chunk %d file %d\n", module.Name, i, j)), 10*(j+1))
+			err := tw.WriteHeader(&tar.Header{
+				Name:    name,
+				Mode:    0600,
+				Size:    int64(len(content)),
+				ModTime: DateTime,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(content)
+			if err != nil {
+				return err
+			}
+			entries[name] = content
+		}
+		err := tw.Close()
+		if err != nil {
+			return err
+		}
+
+		chunkName := module.Name + strconv.Itoa(i) + ".tar"
+		err = os.WriteFile(filepath.Join(chunkDir, chunkName), buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+		rel := module.Name + "_appDataTar/" + chunkName
+		f.Chunks[rel] = buf.Bytes()
+		f.Entries[rel] = entries
+	}
+
+	if module.Apk {
+		apk := []byte("PK\x03\x04 placeholder apk of " + module.Name)
+		err := os.WriteFile(filepath.Join(staging, module.Name+".apk"), apk, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newInfoXml 生成 HiSuite 14 风格的 info.xml，encMsgV3 和 checkMsgV3 由 Pack 填写
+func newInfoXml(modules []Module) *infoxml.InfoXml {
+	ix := &infoxml.InfoXml{}
+
+	header := ix.AddRow("HeaderInfo")
+	header.SetColumnValue("backupVersion", infoxml.IntegerValue(29))
+	header.SetColumnValue("version", infoxml.IntegerValue(29))
+	header.SetColumnValue("miniVersion", infoxml.IntegerValue(1))
+	header.SetColumnValue("autoBackup", infoxml.BooleanValue(false))
+	header.SetColumnValue("isbackupBOPD", infoxml.BooleanValue(false))
+	header.SetColumnValue("dateTime", infoxml.LongValue(DateTime.UnixMilli()))
+	header.SetColumnValue("selectDataSize", infoxml.LongValue(0))
+
+	phone := ix.AddRow("BackupFilePhoneInfo")
+	phone.SetColumnValue("productManufacturer", infoxml.StringValue("HUAWEI"))
+	phone.SetColumnValue("productBrand", infoxml.StringValue("HUAWEI"))
+	phone.SetColumnValue("productModel", infoxml.StringValue("HMA-AL00"))
+	phone.SetColumnValue("productDeviceId", infoxml.StringValue("0123456789ABCDEF"))
+	phone.SetColumnValue("snHash", infoxml.StringValue("0000000000000000000000000000000000000000000000000000000000000000"))
+	phone.SetColumnValue("displayId", infoxml.StringValue("HMA-AL00 10.1.0.163(C00E160R1P8)"))
+	phone.SetColumnValue("versionRelease", infoxml.StringValue("10"))
+	phone.SetColumnValue("versionSdk", infoxml.IntegerValue(29))
+	phone.SetColumnValue("boardPlatform", infoxml.StringValue("kirin980"))
+
+	version := ix.AddRow("BackupFileVersionInfo")
+	version.SetColumnValue("backupVersionName", infoxml.StringValue("14.0.0.320"))
+	version.SetColumnValue("dbVersion", infoxml.IntegerValue(3))
+	version.SetColumnValue("softVersion", infoxml.IntegerValue(14))
+
+	typeInfo := ix.AddRow("BackupFilesTypeInfo")
+	typeInfo.SetColumnValue("encrypt_type", infoxml.IntegerValue(1))
+	typeInfo.SetColumnValue("type", infoxml.IntegerValue(0))
+	typeInfo.SetColumnValue("pwkey_salt", infoxml.NullValue())
+
+	for _, module := range modules {
+		row := ix.AddRow("BackupFileModuleInfo")
+		row.SetColumnValue("name", infoxml.StringValue(module.Name))
+		row.SetColumnValue("type", infoxml.IntegerValue(3))
+		row.SetColumnValue("sdkSupport", infoxml.IntegerValue(29))
+		row.SetColumnValue("isBundleApp", infoxml.BooleanValue(false))
+		row.SetColumnValue("recordTotal", infoxml.IntegerValue(module.Chunks))
+		row.SetColumnValue("appSignatures", infoxml.StringValue("0000000000000000000000000000000000000000"))
+	}
+	return ix
+}
+
+// newBackupInfo 生成 backupinfo.ini，apk_size 和 db_size 由 Pack 填写
+func newBackupInfo(modules []Module) *backupinfo.Ini {
+	ini := &backupinfo.Ini{Newline: "\r\n"}
+	ini.AddSection("headerinfo").Set("hisuiteversion", "14.0.0.320")
+
+	names := ""
+	for i, module := range modules {
+		if i > 0 {
+			names += ","
+		}
+		names += module.Name
+	}
+	ini.AddSection("overview").Set("app_info", names)
+
+	for _, module := range modules {
+		section := ini.AddSection(module.Name)
+		section.Set("app_name", module.AppName)
+		section.Set("version_code", strconv.Itoa(module.VersionCode))
+		section.Set("version_name", module.VersionName)
+		section.Set("is_have_db", "1")
+		section.Set("is_hap_app", "0")
+	}
+	return ini
+}
@@ -0,0 +1,211 @@
+package fixture_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/backup"
+	"github.com/Lensual/KobackupCipherTool-go/internal/backupinfo"
+	"github.com/Lensual/KobackupCipherTool-go/internal/doctor"
+	"github.com/Lensual/KobackupCipherTool-go/internal/fixture"
+	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// TestGenerate 检查生成的备份可以用密码解密，分片是合法的 tar，并且 doctor 和 validate 没有发现错误
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	f, err := fixture.Generate(dir, fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Password != fixture.Password {
+		t.Errorf("Password = %q", f.Password)
+	}
+
+	b, err := backup.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Modules) != len(fixture.DefaultModules) {
+		t.Fatalf("got %d modules, want %d", len(b.Modules), len(fixture.DefaultModules))
+	}
+
+	decrypted := 0
+	for _, module := range b.Modules {
+		key, iv, err := backup.ModuleKey(f.Password, module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := b.ChunkFiles(module.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			rel, _ := filepath.Rel(dir, chunk)
+			rel = filepath.ToSlash(rel)
+			in, err := os.Open(chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var plain bytes.Buffer
+			result, err := utils.DecryptVerify(in, &plain, key, iv, utils.ALGO_AES_GCM, nil)
+			in.Close()
+			if err != nil || result.TagErr != nil {
+				t.Fatalf("%s: DecryptVerify = %v, %v", rel, err, result.TagErr)
+			}
+			if !bytes.Equal(plain.Bytes(), f.Chunks[rel]) {
+				t.Errorf("%s: plaintext mismatch", rel)
+			}
+
+			tr := tar.NewReader(&plain)
+			entries := 0
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", rel, err)
+				}
+				content, _ := io.ReadAll(tr)
+				if !bytes.Equal(content, f.Entries[rel][header.Name]) {
+					t.Errorf("%s: %s: content mismatch", rel, header.Name)
+				}
+				entries++
+			}
+			if entries != len(f.Entries[rel]) {
+				t.Errorf("%s: got %d entries, want %d", rel, entries, len(f.Entries[rel]))
+			}
+			decrypted++
+		}
+	}
+	if decrypted != len(f.Chunks) {
+		t.Errorf("decrypted %d chunks, want %d", decrypted, len(f.Chunks))
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "backupinfo.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte{0xff, 0xfe}) {
+		t.Errorf("backupinfo.ini is not UTF-16LE with BOM")
+	}
+	info, err := backupinfo.Parse(filepath.Join(dir, "backupinfo.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := doctor.Check(b, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range findings {
+		t.Errorf("doctor: %s", finding)
+	}
+
+	ix, err := infoxml.Parse(filepath.Join(dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range infoxml.Validate(ix) {
+		t.Errorf("validate: %s", issue)
+	}
+}
+
+// TestGenerateStdlib 只用标准库独立解密生成的分片并重新计算 checkMsgV3 HMAC，
+// 避免加密和解密有对称的错误时其他测试仍然通过
+func TestGenerateStdlib(t *testing.T) {
+	f, err := fixture.Generate(filepath.Join(t.TempDir(), "backup"), fixture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := infoxml.Parse(filepath.Join(f.Dir, "info.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checked := 0
+	for _, row := range ix.GetRowsByTable("BackupFileModuleInfo") {
+		name, err := row.GetColumnString("name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		encMsgV3, err := row.GetColumnString("encMsgV3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkMsgV3, err := row.GetColumnString("checkMsgV3")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// encMsgV3 是 32 字节 salt 和 16 字节 IV 的十六进制
+		salt, err := hex.DecodeString(encMsgV3[:64])
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, err := hex.DecodeString(encMsgV3[64:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(pbkdf2.Key([]byte(f.Password), salt, 5000, 32, sha256.New))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gcm, err := cipher.NewGCMWithNonceSize(block, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// checkMsgV3 的每一项是 HMAC、salt 的十六进制和文件名，以 ** 分隔
+		for _, item := range strings.Split(checkMsgV3, "**") {
+			expected, err := hex.DecodeString(item[:64])
+			if err != nil {
+				t.Fatal(err)
+			}
+			itemSalt, err := hex.DecodeString(item[64:128])
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel := name + "_appDataTar/" + item[129:]
+			ciphertext, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(rel)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// HMAC 的密钥是 PBKDF2 密钥的小写十六进制
+			hmacKey := hex.EncodeToString(pbkdf2.Key([]byte(f.Password), itemSalt, 5000, 32, sha256.New))
+			mac := hmac.New(sha256.New, []byte(hmacKey))
+			mac.Write(ciphertext)
+			if !hmac.Equal(mac.Sum(nil), expected) {
+				t.Errorf("%s: checkMsgV3 HMAC mismatch", rel)
+			}
+
+			// GCM tag 在密文末尾
+			plain, err := gcm.Open(nil, iv, ciphertext, nil)
+			if err != nil {
+				t.Errorf("%s: %v", rel, err)
+				continue
+			}
+			if !bytes.Equal(plain, f.Chunks[rel]) {
+				t.Errorf("%s: plaintext differs from the generated chunk", rel)
+			}
+			checked++
+		}
+	}
+	if checked != len(f.Chunks) {
+		t.Errorf("checked %d chunks, want %d", checked, len(f.Chunks))
+	}
+}
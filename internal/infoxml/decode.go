@@ -0,0 +1,213 @@
+package infoxml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DecodeReport 记录解码时发现的问题
+type DecodeReport struct {
+	UnknownColumns []string // 结构体中没有对应字段的列，已放入 Extra
+	MissingColumns []string // 结构体中有但行里不存在的列
+	Errors         []error  // 类型不匹配、解析失败等错误
+}
+
+// Err 合并所有错误，没有错误时返回 nil
+func (r *DecodeReport) Err() error {
+	return errors.Join(r.Errors...)
+}
+
+// fieldInfo 描述一个带 infoxml tag 的字段
+type fieldInfo struct {
+	index  int
+	column string
+	typ    string
+}
+
+// DecodeTable 把表中的所有行解码为 T
+//
+// T 的字段通过 `infoxml:"column,type"` 映射到列，type 为 string、integer、long、boolean 或 null。
+// null 类型的字段为 bool，表示列为 null 或不存在。
+// 如果 T 有 Extra map[string]Value 字段，没有对应字段的列会保存在 Extra 中。
+func DecodeTable[T any](ix *InfoXml, tableName string) ([]T, DecodeReport, error) {
+	var report DecodeReport
+
+	rows := ix.GetRowsByTable(tableName)
+	if len(rows) == 0 {
+		return nil, report, fmt.Errorf("%s not found", tableName)
+	}
+
+	result := make([]T, 0, len(rows))
+	for i, row := range rows {
+		var v T
+		rowReport, err := DecodeRow(&row, &v)
+		if err != nil {
+			return nil, report, err
+		}
+		for _, err := range rowReport.Errors {
+			report.Errors = append(report.Errors, fmt.Errorf("%s[%d]: %w", tableName, i, err))
+		}
+		report.UnknownColumns = appendUnique(report.UnknownColumns, rowReport.UnknownColumns...)
+		report.MissingColumns = appendUnique(report.MissingColumns, rowReport.MissingColumns...)
+		result = append(result, v)
+	}
+	return result, report, nil
+}
+
+// DecodeRow 把一行解码到 v 指向的结构体，tag 规则同 DecodeTable
+func DecodeRow(row *Row, v any) (DecodeReport, error) {
+	var report DecodeReport
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return report, errors.New("DecodeRow: v must be a pointer to struct")
+	}
+	rv = rv.Elem()
+
+	fields, extra, err := structFields(rv.Type())
+	if err != nil {
+		return report, err
+	}
+
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.column] = true
+
+		val := row.GetColumnValue(field.column)
+		if val == nil {
+			report.MissingColumns = append(report.MissingColumns, field.column)
+		}
+
+		err := setField(rv.Field(field.index), field.typ, val)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("%s: %w", field.column, err))
+		}
+	}
+
+	var extraMap map[string]Value
+	for _, col := range row.Columns {
+		if known[col.Name] {
+			continue
+		}
+		report.UnknownColumns = append(report.UnknownColumns, col.Name)
+		if extra < 0 {
+			continue
+		}
+		if extraMap == nil {
+			extraMap = make(map[string]Value)
+		}
+		if col.Value != nil {
+			extraMap[col.Name] = *col.Value
+		} else {
+			extraMap[col.Name] = Value{}
+		}
+	}
+	if extra >= 0 {
+		rv.Field(extra).Set(reflect.ValueOf(extraMap))
+	}
+
+	return report, nil
+}
+
+var valueMapType = reflect.TypeOf(map[string]Value(nil))
+
+// structFields 解析结构体的 infoxml tag，返回字段列表和 Extra 字段的下标（没有时为 -1）
+func structFields(t reflect.Type) ([]fieldInfo, int, error) {
+	var fields []fieldInfo
+	extra := -1
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name == "Extra" && f.Type == valueMapType {
+			extra = i
+			continue
+		}
+
+		tag, ok := f.Tag.Lookup("infoxml")
+		if !ok || tag == "-" {
+			continue
+		}
+		column, typ, _ := strings.Cut(tag, ",")
+		if column == "" {
+			return nil, -1, fmt.Errorf("%s.%s: empty column name", t.Name(), f.Name)
+		}
+
+		want, ok := fieldKinds[typ]
+		if !ok {
+			return nil, -1, fmt.Errorf("%s.%s: unknown type %q", t.Name(), f.Name, typ)
+		}
+		if f.Type.Kind() != want {
+			return nil, -1, fmt.Errorf("%s.%s: type %s needs %s field", t.Name(), f.Name, typ, want)
+		}
+
+		fields = append(fields, fieldInfo{index: i, column: column, typ: typ})
+	}
+
+	return fields, extra, nil
+}
+
+// fieldKinds 每种列类型对应的字段类型
+var fieldKinds = map[string]reflect.Kind{
+	"string":  reflect.String,
+	"integer": reflect.Int,
+	"long":    reflect.Int64,
+	"boolean": reflect.Bool,
+	"null":    reflect.Bool,
+}
+
+// setField 按类型解析值并写入字段，列不存在或为 null 时保持零值
+func setField(field reflect.Value, typ string, val *Value) error {
+	if typ == "null" {
+		field.SetBool(val.State() != ValuePresent)
+		return nil
+	}
+	if val.State() != ValuePresent {
+		return nil
+	}
+
+	switch typ {
+	case "string":
+		s, err := val.GetString()
+		if err != nil {
+			return err
+		}
+		field.SetString(s)
+	case "integer":
+		n, err := val.GetInteger()
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case "long":
+		n, err := val.GetLong()
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case "boolean":
+		b, err := val.GetBoolean()
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	}
+	return nil
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, existing := range list {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -2,12 +2,14 @@ package infoxml
 
 // HeaderInfo 表示备份文件的头部信息
 type HeaderInfo struct {
-	BackupVersion    int   // 备份版本
-	SelectDataSize   int64 // 选择的数据大小
-	AutoBackup       bool  // 是否自动备份
-	IsbackupBOPD     bool  // 是否备份BOPD
-	Version          int   // 版本号
-	AutoBackupRandom bool  // 自动备份随机值(null)
-	MiniVersion      int   // 最小版本
-	DateTime         int64 // 日期时间
+	BackupVersion    int   `infoxml:"backupVersion,integer"` // 备份版本
+	SelectDataSize   int64 `infoxml:"selectDataSize,long"`   // 选择的数据大小
+	AutoBackup       bool  `infoxml:"autoBackup,boolean"`    // 是否自动备份
+	IsbackupBOPD     bool  `infoxml:"isbackupBOPD,boolean"`  // 是否备份BOPD
+	Version          int   `infoxml:"version,integer"`       // 版本号
+	AutoBackupRandom bool  `infoxml:"autoBackupRandom,null"` // 自动备份随机值(null)
+	MiniVersion      int   `infoxml:"miniVersion,integer"`   // 最小版本
+	DateTime         int64 `infoxml:"dateTime,long"`         // 日期时间
+
+	Extra map[string]Value // 未知的列
 }
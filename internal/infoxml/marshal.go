@@ -0,0 +1,247 @@
+package infoxml
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
+)
+
+// style 新增元素使用的格式，从已有文档中推断
+type style struct {
+	prolog      string // 新文档的 XML 声明
+	rowWs       string // <row> 之前的内容
+	columnWs    string // <column> 之前的内容
+	valueWs     string // <value> 之前的内容
+	columnEndWs string // </column> 之前的内容
+	rowEndWs    string // </row> 之前的内容
+	rootEndWs   string // </info.xml> 之前的内容
+	selfClose   string // value 自闭合的写法，为空时写成 <value ...></value>
+}
+
+// defaultStyle 与 HiSuite 生成的 info.xml 格式一致
+var defaultStyle = style{
+	prolog:      "<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>\n",
+	rowWs:       "\n",
+	columnWs:    "\n",
+	valueWs:     "\n",
+	columnEndWs: "\n",
+	rowEndWs:    "\n",
+	rootEndWs:   "\n",
+	selfClose:   " />",
+}
+
+// valueAttrs Value 的属性名，按默认写出顺序
+var valueAttrs = []string{"String", "Integer", "Long", "Boolean", "Null"}
+
+// inferStyle 从第一个 row、column、value 推断新增元素的格式
+func inferStyle(ix *InfoXml) style {
+	st := defaultStyle
+	if ix.raw != nil {
+		st.rootEndWs = ix.raw.endWs
+	}
+
+	for _, row := range ix.Rows {
+		if row.raw == nil || row.raw.end == "" {
+			continue
+		}
+		st.rowWs = row.raw.ws
+		st.rowEndWs = row.raw.endWs
+		for _, col := range row.Columns {
+			if col.raw == nil || col.raw.end == "" || col.Value == nil || col.Value.raw == nil {
+				continue
+			}
+			st.columnWs = col.raw.ws
+			st.columnEndWs = col.raw.endWs
+			st.valueWs = col.Value.raw.ws
+
+			text := col.Value.raw.text
+			switch {
+			case strings.HasSuffix(text, " />"):
+				st.selfClose = " />"
+			case strings.HasSuffix(text, "/>"):
+				st.selfClose = "/>"
+			default:
+				st.selfClose = ""
+			}
+			return st
+		}
+	}
+	return st
+}
+
+// Marshal 生成 info.xml 内容
+//
+// 由 Parse 或 Unmarshal 得到且没有修改的部分按原始字节写出，
+// 因此未修改的文档可以逐字节还原；新增或修改的部分按推断的格式生成。
+func (ix *InfoXml) Marshal() ([]byte, error) {
+	doc := ix.raw
+	if doc == nil {
+		doc = &rawDocument{
+			prolog:    defaultStyle.prolog,
+			rootStart: "<info.xml>",
+			endWs:     defaultStyle.rootEndWs,
+			rootEnd:   "</info.xml>",
+			style:     defaultStyle,
+		}
+	}
+	st := doc.style
+
+	var b strings.Builder
+	b.WriteString(doc.prolog)
+
+	if doc.rootEnd == "" && len(ix.Rows) > 0 {
+		// 原来是自闭合的 <info.xml/>
+		b.WriteString("<info.xml>")
+		for i := range ix.Rows {
+			writeRow(&b, &ix.Rows[i], st)
+		}
+		b.WriteString(st.rootEndWs)
+		b.WriteString("</info.xml>")
+	} else {
+		b.WriteString(doc.rootStart)
+		for i := range ix.Rows {
+			writeRow(&b, &ix.Rows[i], st)
+		}
+		b.WriteString(doc.endWs)
+		b.WriteString(doc.rootEnd)
+	}
+
+	b.WriteString(doc.epilog)
+	if doc.encoding == textenc.UTF8 && !doc.bom {
+		return []byte(b.String()), nil
+	}
+	// 按原始编码写回
+	return textenc.Encode(b.String(), doc.encoding, doc.bom), nil
+}
+
+// WriteFile 把 info.xml 写入文件
+func (ix *InfoXml) WriteFile(xmlPath string) error {
+	content, err := ix.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(xmlPath, content, 0644)
+}
+
+func writeRow(b *strings.Builder, r *Row, st style) {
+	start, end := "", "</row>"
+	ws, endWs := st.rowWs, st.rowEndWs
+	if r.raw != nil {
+		ws, endWs = r.raw.ws, r.raw.endWs
+		selfClosed := r.raw.end == ""
+		if r.raw.attr == r.Table && !(selfClosed && len(r.Columns) > 0) {
+			start, end = r.raw.start, r.raw.end
+		}
+		if selfClosed && len(r.Columns) > 0 {
+			endWs = st.rowEndWs
+		}
+	}
+	if start == "" {
+		start = `<row table="` + escapeAttr(r.Table) + `">`
+	}
+
+	b.WriteString(ws)
+	b.WriteString(start)
+	for i := range r.Columns {
+		writeColumn(b, &r.Columns[i], st)
+	}
+	b.WriteString(endWs)
+	b.WriteString(end)
+}
+
+func writeColumn(b *strings.Builder, c *Column, st style) {
+	start, end := "", "</column>"
+	ws, endWs := st.columnWs, st.columnEndWs
+	if c.raw != nil {
+		ws, endWs = c.raw.ws, c.raw.endWs
+		selfClosed := c.raw.end == ""
+		if c.raw.attr == c.Name && !(selfClosed && c.Value != nil) {
+			start, end = c.raw.start, c.raw.end
+		}
+		if selfClosed && c.Value != nil {
+			endWs = st.columnEndWs
+		}
+	}
+	if start == "" {
+		start = `<column name="` + escapeAttr(c.Name) + `">`
+	}
+
+	b.WriteString(ws)
+	b.WriteString(start)
+	if c.Value != nil {
+		writeValue(b, c.Value, st)
+	}
+	b.WriteString(endWs)
+	b.WriteString(end)
+}
+
+func writeValue(b *strings.Builder, v *Value, st style) {
+	if v.raw != nil {
+		b.WriteString(v.raw.ws)
+		if v.fields() == v.raw.fields {
+			b.WriteString(v.raw.text)
+			return
+		}
+	} else {
+		b.WriteString(st.valueWs)
+	}
+
+	// 先按原始顺序，再按默认顺序写出类型属性和非空属性
+	var order []string
+	if v.raw != nil {
+		order = append(order, v.raw.order...)
+	}
+	for _, name := range valueAttrs {
+		if !slices.Contains(order, name) {
+			order = append(order, name)
+		}
+	}
+
+	b.WriteString("<value")
+	for _, name := range order {
+		val := v.attr(name)
+		if val == "" && name != v.Type {
+			continue
+		}
+		b.WriteString(" " + name + `="` + escapeAttr(val) + `"`)
+	}
+	if st.selfClose == "" {
+		b.WriteString("></value>")
+	} else {
+		b.WriteString(st.selfClose)
+	}
+}
+
+// attr 根据属性名获取属性值
+func (v *Value) attr(name string) string {
+	switch name {
+	case "String":
+		return v.String
+	case "Integer":
+		return v.Integer
+	case "Long":
+		return v.Long
+	case "Boolean":
+		return v.Boolean
+	case "Null":
+		return v.Null
+	}
+	return ""
+}
+
+var attrReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"\t", "&#9;",
+	"\n", "&#10;",
+	"\r", "&#13;",
+)
+
+// escapeAttr 转义属性值
+func escapeAttr(s string) string {
+	return attrReplacer.Replace(s)
+}
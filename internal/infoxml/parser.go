@@ -3,25 +3,35 @@ package infoxml
 import (
 	"encoding/xml"
 	"errors"
-	"os"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
 )
 
 // InfoXml 结构体用于解析 info.xml
 type InfoXml struct {
 	XMLName xml.Name `xml:"info.xml"`
 	Rows    []Row    `xml:"row"`
+
+	raw *rawDocument // 解析时记录的原始格式，用于无损写回
 }
 
 // Row 表示 info.xml 中的每一行
 type Row struct {
 	Table   string   `xml:"table,attr"`
 	Columns []Column `xml:"column"`
+
+	raw *rawElement
 }
 
 // Column 表示 row 中的每一列
 type Column struct {
 	Name  string `xml:"name,attr"`
 	Value *Value `xml:"value"`
+
+	raw *rawElement
 }
 
 // Value 表示 column 的值
@@ -31,43 +41,123 @@ type Value struct {
 	Long    string `xml:"Long,attr"`
 	Boolean string `xml:"Boolean,attr"`
 	Null    string `xml:"Null,attr"`
+
+	// Type 实际出现的类型属性名，如 "String"、"Integer"、"Null"
+	Type string `xml:"-"`
+
+	raw *rawValue
 }
 
-// GetString 获取 String 类型的值
-func (v *Value) GetString() string {
-	return v.String
-}
-
-// GetInteger 获取 Integer 类型的值
-func (v *Value) GetInteger() int {
-	var n int
-	if v.Integer != "" {
-		// 简单解析整数
-		for _, c := range v.Integer {
-			if c >= '0' && c <= '9' {
-				n = n*10 + int(c-'0')
-			}
+var (
+	ErrColumnNotFound = errors.New("column not found")
+	ErrNullValue      = errors.New("value is null")
+	ErrTypeMismatch   = errors.New("value type mismatch")
+)
+
+// ValueState 表示列值的状态
+type ValueState int
+
+const (
+	ValueMissing ValueState = iota // 列不存在
+	ValueNull                      // Null="null"
+	ValuePresent                   // 有值
+)
+
+// UnmarshalXML 解析属性并记录实际出现的类型
+func (v *Value) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "String":
+			v.String = attr.Value
+		case "Integer":
+			v.Integer = attr.Value
+		case "Long":
+			v.Long = attr.Value
+		case "Boolean":
+			v.Boolean = attr.Value
+		case "Null":
+			v.Null = attr.Value
+		default:
+			continue
+		}
+		if v.Type == "" {
+			v.Type = attr.Name.Local
 		}
 	}
-	return n
+	return d.Skip()
 }
 
-// GetLong 获取 Long 类型的值
-func (v *Value) GetLong() int64 {
-	var n int64
-	if v.Long != "" {
-		for _, c := range v.Long {
-			if c >= '0' && c <= '9' {
-				n = n*10 + int64(c-'0')
-			}
-		}
+// State 返回值的状态
+func (v *Value) State() ValueState {
+	if v == nil {
+		return ValueMissing
+	}
+	if v.IsNull() {
+		return ValueNull
+	}
+	return ValuePresent
+}
+
+// check 检查值可以按 typ 类型读取
+func (v *Value) check(typ string) error {
+	switch v.State() {
+	case ValueMissing:
+		return ErrColumnNotFound
+	case ValueNull:
+		return ErrNullValue
+	}
+	if v.Type != typ {
+		return fmt.Errorf("%w: want %s, got %s", ErrTypeMismatch, typ, v.Type)
+	}
+	return nil
+}
+
+// GetString 获取 String 类型的值
+//
+// 值不存在返回 ErrColumnNotFound，null 返回 ErrNullValue，类型不符返回 ErrTypeMismatch
+func (v *Value) GetString() (string, error) {
+	err := v.check("String")
+	if err != nil {
+		return "", err
+	}
+	return v.String, nil
+}
+
+// GetInteger 严格解析 Integer 类型的值，错误同 GetString，无法解析时返回解析错误
+func (v *Value) GetInteger() (int, error) {
+	err := v.check("Integer")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(v.Integer, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// GetLong 严格解析 Long 类型的值，错误同 GetInteger
+func (v *Value) GetLong() (int64, error) {
+	err := v.check("Long")
+	if err != nil {
+		return 0, err
 	}
-	return n
+	return strconv.ParseInt(v.Long, 10, 64)
 }
 
-// GetBoolean 获取 Boolean 类型的值
-func (v *Value) GetBoolean() bool {
-	return v.Boolean == "true"
+// GetBoolean 严格解析 Boolean 类型的值，错误同 GetInteger
+func (v *Value) GetBoolean() (bool, error) {
+	err := v.check("Boolean")
+	if err != nil {
+		return false, err
+	}
+	switch v.Boolean {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean: %q", v.Boolean)
 }
 
 // IsNull 判断是否为 null
@@ -75,20 +165,14 @@ func (v *Value) IsNull() bool {
 	return v.Null == "null"
 }
 
-// Parse 从 info.xml 文件中解析
+// Parse 从 info.xml 文件中解析，文件流式解码，解码后不能超过 MaxSize
 func Parse(xmlPath string) (*InfoXml, error) {
-	content, err := os.ReadFile(xmlPath)
+	content, enc, bom, err := textenc.ReadFileDecoded(xmlPath, MaxSize)
 	if err != nil {
 		return nil, err
 	}
 
-	var infoXml InfoXml
-	err = xml.Unmarshal(content, &infoXml)
-	if err != nil {
-		return nil, err
-	}
-
-	return &infoXml, nil
+	return unmarshalDecoded(content, enc, bom)
 }
 
 // GetRowsByTable 根据表名获取所有行
@@ -102,11 +186,11 @@ func (ix *InfoXml) GetRowsByTable(tableName string) []Row {
 	return result
 }
 
-// GetFirstRowByTable 根据表名获取第一行
+// GetFirstRowByTable 根据表名获取第一行，返回的指针可以用来修改该行
 func (ix *InfoXml) GetFirstRowByTable(tableName string) *Row {
-	for _, row := range ix.Rows {
-		if row.Table == tableName {
-			return &row
+	for i := range ix.Rows {
+		if ix.Rows[i].Table == tableName {
+			return &ix.Rows[i]
 		}
 	}
 	return nil
@@ -123,151 +207,150 @@ func (r *Row) GetColumnValue(columnName string) *Value {
 }
 
 // GetColumnString 根据列名获取字符串值
-func (r *Row) GetColumnString(columnName string) string {
-	val := r.GetColumnValue(columnName)
-	if val == nil {
-		return ""
+//
+// 列不存在返回 ErrColumnNotFound，null 返回 ErrNullValue，类型不符返回 ErrTypeMismatch，
+// 错误中包含列名
+func (r *Row) GetColumnString(columnName string) (string, error) {
+	val, err := r.GetColumnValue(columnName).GetString()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", columnName, err)
 	}
-	return val.GetString()
+	return val, nil
 }
 
-// GetColumnInteger 根据列名获取整数值
-func (r *Row) GetColumnInteger(columnName string) int {
-	val := r.GetColumnValue(columnName)
-	if val == nil {
-		return 0
+// GetColumnInteger 根据列名严格解析整数值，错误同 GetColumnString，无法解析时返回解析错误
+func (r *Row) GetColumnInteger(columnName string) (int, error) {
+	val, err := r.GetColumnValue(columnName).GetInteger()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", columnName, err)
 	}
-	return val.GetInteger()
+	return val, nil
 }
 
-// GetColumnLong 根据列名获取长整数值
-func (r *Row) GetColumnLong(columnName string) int64 {
-	val := r.GetColumnValue(columnName)
-	if val == nil {
-		return 0
+// GetColumnLong 根据列名严格解析长整数值，错误同 GetColumnInteger
+func (r *Row) GetColumnLong(columnName string) (int64, error) {
+	val, err := r.GetColumnValue(columnName).GetLong()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", columnName, err)
 	}
-	return val.GetLong()
+	return val, nil
 }
 
-// GetColumnBoolean 根据列名获取布尔值
-func (r *Row) GetColumnBoolean(columnName string) bool {
-	val := r.GetColumnValue(columnName)
-	if val == nil {
-		return false
+// GetColumnBoolean 根据列名严格解析布尔值，错误同 GetColumnInteger
+func (r *Row) GetColumnBoolean(columnName string) (bool, error) {
+	val, err := r.GetColumnValue(columnName).GetBoolean()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", columnName, err)
 	}
-	return val.GetBoolean()
+	return val, nil
+}
+
+// ColumnState 返回列的状态：不存在、null 或有值
+func (r *Row) ColumnState(columnName string) ValueState {
+	return r.GetColumnValue(columnName).State()
+}
+
+// StringValue 创建 String 类型的值
+func StringValue(s string) Value {
+	return Value{String: s, Type: "String"}
+}
+
+// IntegerValue 创建 Integer 类型的值
+func IntegerValue(n int) Value {
+	return Value{Integer: strconv.Itoa(n), Type: "Integer"}
+}
+
+// LongValue 创建 Long 类型的值
+func LongValue(n int64) Value {
+	return Value{Long: strconv.FormatInt(n, 10), Type: "Long"}
+}
+
+// BooleanValue 创建 Boolean 类型的值
+func BooleanValue(b bool) Value {
+	return Value{Boolean: strconv.FormatBool(b), Type: "Boolean"}
+}
+
+// NullValue 创建 null 值
+func NullValue() Value {
+	return Value{Null: "null", Type: "Null"}
 }
 
-// GetColumnNull 根据列名判断是否为null
-func (r *Row) GetColumnNull(columnName string) bool {
-	val := r.GetColumnValue(columnName)
-	if val == nil {
-		return true
+// SetColumnValue 设置列的值，列不存在时追加到行末
+//
+// 已有列保留原来的格式，值没有变化时 Marshal 仍按原始字节写出
+func (r *Row) SetColumnValue(columnName string, v Value) {
+	for i := range r.Columns {
+		if r.Columns[i].Name != columnName {
+			continue
+		}
+		if old := r.Columns[i].Value; old != nil && v.raw == nil {
+			v.raw = old.raw
+		}
+		r.Columns[i].Value = &v
+		return
 	}
-	return val.IsNull()
+	r.Columns = append(r.Columns, Column{Name: columnName, Value: &v})
+}
+
+// RemoveColumn 删除列，返回列是否存在
+func (r *Row) RemoveColumn(columnName string) bool {
+	n := len(r.Columns)
+	r.Columns = slices.DeleteFunc(r.Columns, func(col Column) bool {
+		return col.Name == columnName
+	})
+	return len(r.Columns) != n
+}
+
+// AddRow 在末尾追加一行并返回它
+//
+// 返回的指针在下一次修改 Rows 之前有效
+func (ix *InfoXml) AddRow(tableName string) *Row {
+	ix.Rows = append(ix.Rows, Row{Table: tableName})
+	return &ix.Rows[len(ix.Rows)-1]
+}
+
+// RemoveRows 删除 fn 返回 true 的行，返回删除的行数
+func (ix *InfoXml) RemoveRows(fn func(*Row) bool) int {
+	n := len(ix.Rows)
+	ix.Rows = slices.DeleteFunc(ix.Rows, func(row Row) bool {
+		return fn(&row)
+	})
+	return n - len(ix.Rows)
 }
 
+// 以下表访问函数忽略 DecodeReport 中的问题，需要检查未知列和类型错误时直接使用 DecodeTable
+
 // GetHeaderInfo 获取 HeaderInfo 表的数据
 func (ix *InfoXml) GetHeaderInfo() (*HeaderInfo, error) {
-	row := ix.GetFirstRowByTable("HeaderInfo")
-	if row == nil {
-		return nil, errors.New("HeaderInfo not found")
-	}
-	return &HeaderInfo{
-		BackupVersion:    row.GetColumnInteger("backupVersion"),
-		SelectDataSize:   row.GetColumnLong("selectDataSize"),
-		AutoBackup:       row.GetColumnBoolean("autoBackup"),
-		IsbackupBOPD:     row.GetColumnBoolean("isbackupBOPD"),
-		Version:          row.GetColumnInteger("version"),
-		AutoBackupRandom: row.GetColumnNull("autoBackupRandom"),
-		MiniVersion:      row.GetColumnInteger("miniVersion"),
-		DateTime:         row.GetColumnLong("dateTime"),
-	}, nil
+	return decodeFirst[HeaderInfo](ix, "HeaderInfo")
 }
 
 // GetBackupFilePhoneInfo 获取 BackupFilePhoneInfo 表的数据
 func (ix *InfoXml) GetBackupFilePhoneInfo() (*BackupFilePhoneInfo, error) {
-	row := ix.GetFirstRowByTable("BackupFilePhoneInfo")
-	if row == nil {
-		return nil, errors.New("BackupFilePhoneInfo not found")
-	}
-	return &BackupFilePhoneInfo{
-		ProductManufacturer: row.GetColumnString("productManufacturer"),
-		SnHash:              row.GetColumnString("snHash"),
-		VersionSdk:          row.GetColumnInteger("versionSdk"),
-		DisplayId:           row.GetColumnString("displayId"),
-		BOPD_reason:         row.GetColumnString("BOPD_reason"),
-		BOPD_running_mode:   row.GetColumnString("BOPD_running_mode"),
-		BoardPlatform:       row.GetColumnString("boardPlatform"),
-		ProductBrand:        row.GetColumnString("productBrand"),
-		ProductModel:        row.GetColumnString("productModel"),
-		VersionRelease:      row.GetColumnString("versionRelease"),
-		BOPD_info:           row.GetColumnString("BOPD_info"),
-		ProductDeviceId:     row.GetColumnString("productDeviceId"),
-	}, nil
+	return decodeFirst[BackupFilePhoneInfo](ix, "BackupFilePhoneInfo")
 }
 
 // GetBackupFileVersionInfo 获取 BackupFileVersionInfo 表的数据
 func (ix *InfoXml) GetBackupFileVersionInfo() (*BackupFileVersionInfo, error) {
-	row := ix.GetFirstRowByTable("BackupFileVersionInfo")
-	if row == nil {
-		return nil, errors.New("BackupFileVersionInfo not found")
-	}
-	return &BackupFileVersionInfo{
-		DbVersion:         row.GetColumnInteger("dbVersion"),
-		SoftVersion:       row.GetColumnInteger("softVersion"),
-		BackupVersionName: row.GetColumnString("backupVersionName"),
-	}, nil
+	return decodeFirst[BackupFileVersionInfo](ix, "BackupFileVersionInfo")
 }
 
 // GetBackupFilesTypeInfo 获取 BackupFilesTypeInfo 表的数据
 func (ix *InfoXml) GetBackupFilesTypeInfo() (*BackupFilesTypeInfo, error) {
-	row := ix.GetFirstRowByTable("BackupFilesTypeInfo")
-	if row == nil {
-		return nil, errors.New("BackupFilesTypeInfo not found")
-	}
-	return &BackupFilesTypeInfo{
-		EncryptType:   row.GetColumnInteger("encrypt_type"),
-		TypeAttch:     row.GetColumnInteger("type_attch"),
-		PromptMsg:     row.GetColumnNull("promptMsg"),
-		EPerbackupkey: row.GetColumnNull("e_perbackupkey"),
-		PwkeySalt:     row.GetColumnNull("pwkey_salt"),
-		Type:          row.GetColumnInteger("type"),
-	}, nil
+	return decodeFirst[BackupFilesTypeInfo](ix, "BackupFilesTypeInfo")
 }
 
 // GetBackupFileModuleInfo 获取所有 BackupFileModuleInfo 表的数据
 func (ix *InfoXml) GetBackupFileModuleInfo() ([]BackupFileModuleInfo, error) {
-	rows := ix.GetRowsByTable("BackupFileModuleInfo")
-	if len(rows) == 0 {
-		return nil, errors.New("BackupFileModuleInfo not found")
-	}
+	result, _, err := DecodeTable[BackupFileModuleInfo](ix, "BackupFileModuleInfo")
+	return result, err
+}
 
-	var result []BackupFileModuleInfo
-	for _, row := range rows {
-		info := BackupFileModuleInfo{
-			DeviceAllLanguages: row.GetColumnNull("deviceAllLanguages"),
-			CheckInfoType:      row.GetColumnNull("checkInfoType"),
-			DeviceDensityDpi:   row.GetColumnInteger("deviceDensityDpi"),
-			Tables:             row.GetColumnNull("tables"),
-			CheckMsgV3:         row.GetColumnString("checkMsgV3"),
-			IsBundleApp:        row.GetColumnBoolean("isBundleApp"),
-			Name:               row.GetColumnString("name"),
-			Type:               row.GetColumnInteger("type"),
-			SdkSupport:         row.GetColumnInteger("sdkSupport"),
-			DeviceCpuArchType:  row.GetColumnNull("deviceCpuArchType"),
-			CheckInfo:          row.GetColumnNull("checkInfo"),
-			AppSignatures:      row.GetColumnString("appSignatures"),
-			ArkBcVersion:       row.GetColumnLong("arkBcVersion"),
-			CheckComplexMsgV3:  row.GetColumnNull("checkComplexMsgV3"),
-			RecordTotal:        row.GetColumnInteger("recordTotal"),
-			IsCopyFileEncrypt:  row.GetColumnBoolean("isCopyFileEncrypt"),
-			CopyFilePath:       row.GetColumnNull("copyFilePath"),
-			CheckMsg:           row.GetColumnNull("checkMsg"),
-			EncMsgV3:           row.GetColumnString("encMsgV3"),
-		}
-		result = append(result, info)
+// decodeFirst 解码表的第一行
+func decodeFirst[T any](ix *InfoXml, tableName string) (*T, error) {
+	result, _, err := DecodeTable[T](ix, tableName)
+	if err != nil {
+		return nil, err
 	}
-
-	return result, nil
+	return &result[0], nil
 }
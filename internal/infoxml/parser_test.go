@@ -1,11 +1,18 @@
 package infoxml_test
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/Lensual/KobackupCipherTool-go/internal/infoxml"
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
 )
 
 // TestParseFromWorkspace 从工作区目录读取 info.xml 并打印解析结果
@@ -27,6 +34,19 @@ func TestParseFromWorkspace(t *testing.T) {
 
 	// 打印解析结果
 	printParseResults(infoXml)
+
+	// 未修改时应逐字节写回
+	content, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("Failed to read info.xml: %v", err)
+	}
+	out, err := infoXml.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal info.xml: %v", err)
+	}
+	if string(out) != string(content) {
+		t.Errorf("Marshal output differs from info.xml")
+	}
 }
 
 // printParseResults 打印所有解析结果
@@ -103,3 +123,343 @@ func printParseResults(infoXml *infoxml.InfoXml) {
 		}
 	}
 }
+
+// TestRowGetters 检查 getter 严格解析，并区分不存在、null、类型不符和有值
+func TestRowGetters(t *testing.T) {
+	content := `<info.xml><row table="HeaderInfo">
+<column name="negative"><value Integer="-1" /></column>
+<column name="garbage"><value Integer="12a3" /></column>
+<column name="long"><value Long="1728491629000" /></column>
+<column name="null"><value Null="null" /></column>
+<column name="bool"><value Boolean="true" /></column>
+<column name="zero"><value Integer="0" /></column>
+<column name="overflow"><value Integer="4294967296" /></column>
+<column name="string"><value String="a" /></column>
+<column name="badbool"><value Boolean="yes" /></column>
+</row></info.xml>`
+
+	var infoXml infoxml.InfoXml
+	err := xml.Unmarshal([]byte(content), &infoXml)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	row := infoXml.GetFirstRowByTable("HeaderInfo")
+
+	if n, err := row.GetColumnInteger("negative"); err != nil || n != -1 {
+		t.Errorf("negative = %d, %v", n, err)
+	}
+	if n, err := row.GetColumnInteger("zero"); err != nil || n != 0 {
+		t.Errorf("zero = %d, %v", n, err)
+	}
+	if n, err := row.GetColumnLong("long"); err != nil || n != 1728491629000 {
+		t.Errorf("long = %d, %v", n, err)
+	}
+	if b, err := row.GetColumnBoolean("bool"); err != nil || !b {
+		t.Errorf("bool = %v, %v", b, err)
+	}
+	if s, err := row.GetColumnString("string"); err != nil || s != "a" {
+		t.Errorf("string = %q, %v", s, err)
+	}
+
+	// 每个 getter 都区分不存在、null 和类型不符
+	getters := map[string]func(column string) error{
+		"String": func(column string) error {
+			_, err := row.GetColumnString(column)
+			return err
+		},
+		"Integer": func(column string) error {
+			_, err := row.GetColumnInteger(column)
+			return err
+		},
+		"Long": func(column string) error {
+			_, err := row.GetColumnLong(column)
+			return err
+		},
+		"Boolean": func(column string) error {
+			_, err := row.GetColumnBoolean(column)
+			return err
+		},
+	}
+	// 每种类型一个类型不符的列
+	mismatched := map[string]string{"String": "zero", "Integer": "long", "Long": "zero", "Boolean": "string"}
+	for typ, get := range getters {
+		cases := []struct {
+			column string
+			want   error
+		}{
+			{"missing", infoxml.ErrColumnNotFound},
+			{"null", infoxml.ErrNullValue},
+			{mismatched[typ], infoxml.ErrTypeMismatch},
+		}
+		for _, c := range cases {
+			if err := get(c.column); !errors.Is(err, c.want) {
+				t.Errorf("GetColumn%s(%s) = %v, want %v", typ, c.column, err, c.want)
+			}
+		}
+	}
+
+	// 无法解析的值返回解析错误
+	for _, column := range []string{"garbage", "overflow"} {
+		if n, err := row.GetColumnInteger(column); err == nil {
+			t.Errorf("GetColumnInteger(%s) = %d, want error", column, n)
+		}
+	}
+	if b, err := row.GetColumnBoolean("badbool"); err == nil {
+		t.Errorf("GetColumnBoolean(badbool) = %v, want error", b)
+	}
+
+	states := map[string]infoxml.ValueState{
+		"zero":    infoxml.ValuePresent,
+		"null":    infoxml.ValueNull,
+		"missing": infoxml.ValueMissing,
+	}
+	for name, want := range states {
+		if got := row.ColumnState(name); got != want {
+			t.Errorf("ColumnState(%s) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+// TestDecodeTable 检查未知列进入 Extra，类型不匹配被报告
+func TestDecodeTable(t *testing.T) {
+	content := `<info.xml>
+<row table="BackupFileVersionInfo">
+<column name="dbVersion"><value Long="3" /></column>
+<column name="softVersion"><value Integer="7" /></column>
+<column name="newColumn"><value String="new" /></column>
+</row></info.xml>`
+
+	var infoXml infoxml.InfoXml
+	err := xml.Unmarshal([]byte(content), &infoXml)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	infos, report, err := infoxml.DecodeTable[infoxml.BackupFileVersionInfo](&infoXml, "BackupFileVersionInfo")
+	if err != nil {
+		t.Fatalf("DecodeTable: %v", err)
+	}
+	if len(infos) != 1 || infos[0].SoftVersion != 7 {
+		t.Fatalf("infos = %+v", infos)
+	}
+	if infos[0].Extra["newColumn"].String != "new" {
+		t.Errorf("Extra = %+v", infos[0].Extra)
+	}
+	if len(report.UnknownColumns) != 1 || report.UnknownColumns[0] != "newColumn" {
+		t.Errorf("UnknownColumns = %v", report.UnknownColumns)
+	}
+	if len(report.MissingColumns) != 1 || report.MissingColumns[0] != "backupVersionName" {
+		t.Errorf("MissingColumns = %v", report.MissingColumns)
+	}
+	if !errors.Is(report.Err(), infoxml.ErrTypeMismatch) {
+		t.Errorf("Err() = %v, want ErrTypeMismatch", report.Err())
+	}
+}
+
+// TestMarshalRoundTrip 检查未修改的文档逐字节还原，修改后的文档可以重新解析
+func TestMarshalRoundTrip(t *testing.T) {
+	content := "<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>\r\n" +
+		"<!-- comment -->\r\n" +
+		"<info.xml>\r\n" +
+		"<row table=\"HeaderInfo\">\r\n" +
+		"<column name=\"backupVersion\">\r\n<value Integer=\"29\" />\r\n</column>\r\n" +
+		"<column name=\"quoted\">\r\n<value String=\"a &quot;b&quot; &amp; c\"/>\r\n</column>\r\n" +
+		"<column name=\"null\">\r\n<value Null=\"null\" String=\"\"></value>\r\n</column>\r\n" +
+		"<column name=\"empty\"/>\r\n" +
+		"</row>\r\n" +
+		"<row table=\"BackupFileModuleInfo\" />\r\n" +
+		"</info.xml>\r\n"
+
+	infoXml, err := infoxml.Unmarshal([]byte(content))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	out, err := infoXml.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(out) != content {
+		t.Fatalf("round trip mismatch:\n%q\n%q", out, content)
+	}
+
+	// 修改已有的值，新增列和行
+	row := infoXml.GetFirstRowByTable("HeaderInfo")
+	row.SetColumnValue("backupVersion", infoxml.IntegerValue(30))
+	row.SetColumnValue("dateTime", infoxml.LongValue(1728491629000))
+	infoXml.AddRow("BackupFileVersionInfo").SetColumnValue("backupVersionName", infoxml.StringValue("<14.5>"))
+
+	out, err = infoXml.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(out), "<value Integer=\"30\" />\r\n") {
+		t.Errorf("modified value not written in original style:\n%s", out)
+	}
+
+	reparsed, err := infoxml.Unmarshal(out)
+	if err != nil {
+		t.Fatalf("Unmarshal modified: %v", err)
+	}
+	headerInfo, err := reparsed.GetHeaderInfo()
+	if err != nil || headerInfo.BackupVersion != 30 || headerInfo.DateTime != 1728491629000 {
+		t.Errorf("HeaderInfo = %+v, %v", headerInfo, err)
+	}
+	versionInfo, err := reparsed.GetBackupFileVersionInfo()
+	if err != nil || versionInfo.BackupVersionName != "<14.5>" {
+		t.Errorf("BackupFileVersionInfo = %+v, %v", versionInfo, err)
+	}
+	quoted, err := reparsed.GetFirstRowByTable("HeaderInfo").GetColumnString("quoted")
+	if err != nil || quoted != `a "b" & c` {
+		t.Errorf("quoted = %q, %v", quoted, err)
+	}
+}
+
+// TestValidate 检查 schema 校验能发现常见问题
+func TestValidate(t *testing.T) {
+	content := `<info.xml>
+<row table="HeaderInfo"><column name="backupVersion"><value Integer="29" /></column></row>
+<row table="NewTable"><column name="x"><value String="y" /></column></row>
+<row table="BackupFileModuleInfo"><column name="name"><value String="com.a" /></column><column name="encMsgV3"><value String="abc" /></column></row>
+<row table="BackupFileModuleInfo"><column name="name"><value String="com.a" /></column><column name="newColumn"><value Long="1" /></column></row>
+</info.xml>`
+
+	infoXml, err := infoxml.Unmarshal([]byte(content))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	found := map[string]bool{}
+	for _, issue := range infoxml.Validate(infoXml) {
+		found[issue.String()] = true
+	}
+
+	for _, want := range []string{
+		"error: HeaderInfo[0].dateTime: required column is missing or null",
+		"warning: NewTable[0]: unknown table (1 rows)",
+		"error: BackupFileModuleInfo[0].encMsgV3: encMsgV3 must be 96 characters",
+		"error: BackupFileModuleInfo[1].name: duplicated module name \"com.a\", first at row 0",
+		"warning: BackupFileModuleInfo[1].newColumn: unknown column",
+	} {
+		if !found[want] {
+			t.Errorf("missing issue %q, got %v", want, found)
+		}
+	}
+}
+
+// TestSchemaFor 检查按 backupVersion 选择 schema，以及 Validate 使用选中的 schema
+func TestSchemaFor(t *testing.T) {
+	// 追加一个新版本的 schema，在 29 的基础上多一个表
+	old := infoxml.Schemas
+	t.Cleanup(func() { infoxml.Schemas = old })
+	newer := infoxml.Schema{
+		MinBackupVersion: 32,
+		Tables: append(slices.Clone(old[0].Tables), infoxml.TableSchema{
+			Name: "NewTable", Type: reflect.TypeFor[struct{}](),
+		}),
+	}
+	infoxml.Schemas = []infoxml.Schema{old[0], newer}
+
+	cases := []struct {
+		backupVersion int
+		want          int
+		exact         bool
+	}{
+		{10, 29, false},
+		{29, 29, true},
+		{30, 29, false},
+		{32, 32, true},
+		{40, 32, false},
+	}
+	for _, c := range cases {
+		schema, exact := infoxml.SchemaFor(c.backupVersion)
+		if schema.MinBackupVersion != c.want || exact != c.exact {
+			t.Errorf("SchemaFor(%d) = %d, %v, want %d, %v", c.backupVersion, schema.MinBackupVersion, exact, c.want, c.exact)
+		}
+	}
+
+	for _, c := range []struct {
+		backupVersion int
+		unknown       bool
+	}{
+		{29, true},
+		{32, false},
+	} {
+		content := fmt.Sprintf(`<info.xml>
+<row table="HeaderInfo"><column name="backupVersion"><value Integer="%d" /></column><column name="dateTime"><value Long="0" /></column></row>
+<row table="NewTable" />
+</info.xml>`, c.backupVersion)
+		infoXml, err := infoxml.Unmarshal([]byte(content))
+		if err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		unknown := false
+		for _, issue := range infoxml.Validate(infoXml) {
+			if issue.Table == "NewTable" {
+				unknown = true
+			}
+		}
+		if unknown != c.unknown {
+			t.Errorf("backupVersion %d: NewTable reported = %v, want %v", c.backupVersion, unknown, c.unknown)
+		}
+	}
+}
+
+// TestUnmarshalUTF16 检查 UTF-16 编码的 info.xml 能被解析，并按原始编码写回
+func TestUnmarshalUTF16(t *testing.T) {
+	content := "<?xml version='1.0' encoding='UTF-16' standalone='yes' ?>\n" +
+		"<info.xml>\n<row table=\"HeaderInfo\">\n" +
+		"<column name=\"backupVersion\">\n<value Integer=\"29\" />\n</column>\n" +
+		"<column name=\"deviceName\">\n<value String=\"华为\" />\n</column>\n" +
+		"</row>\n</info.xml>\n"
+	encoded := textenc.Encode(content, textenc.UTF16LE, true)
+
+	infoXml, err := infoxml.Unmarshal(encoded)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	s, err := infoXml.GetFirstRowByTable("HeaderInfo").GetColumnString("deviceName")
+	if err != nil || s != "华为" {
+		t.Errorf("deviceName = %q, %v", s, err)
+	}
+
+	out, err := infoXml.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(out, encoded) {
+		t.Errorf("round trip mismatch:\n%q\n%q", out, encoded)
+	}
+}
+
+// FuzzUnmarshal 检查任意内容都不会 panic，解析成功的文档写回后逐字节一致
+func FuzzUnmarshal(f *testing.F) {
+	f.Add([]byte("<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>\r\n<info.xml>\r\n" +
+		"<row table=\"HeaderInfo\">\r\n<column name=\"backupVersion\">\r\n<value Integer=\"29\" />\r\n</column>\r\n</row>\r\n" +
+		"<row table=\"BackupFileModuleInfo\">\r\n<column name=\"name\">\r\n<value String=\"com.a\" />\r\n</column>\r\n" +
+		"<column name=\"null\">\r\n<value Null=\"null\" String=\"\"></value>\r\n</column>\r\n<column name=\"empty\"/>\r\n</row>\r\n" +
+		"</info.xml>\r\n"))
+	f.Add(textenc.Encode("<?xml version='1.0' encoding='UTF-16' ?>\n<info.xml><row table=\"t\"/></info.xml>", textenc.UTF16LE, true))
+	f.Add([]byte("<info.xml><row table=\"t\"><column name=\"c\"><value Long=\"1\" Integer=\"2\"/></column></row></info.xml>"))
+	f.Add([]byte("<info.xml><row><row></row></row></info.xml>"))
+	f.Add([]byte("<info.xml>&amp;<!-- c --><![CDATA[x]]></info.xml>"))
+	f.Add([]byte("<info.xml>"))
+	f.Add([]byte{0xFF, 0xFE, '<'})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		infoXml, err := infoxml.Unmarshal(content)
+		if err != nil {
+			return
+		}
+		infoxml.Validate(infoXml)
+		out, err := infoXml.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		// 只有能被无损解码的内容才能逐字节写回，截断的编码单元会被替换为 U+FFFD
+		decoded, enc, bom := textenc.DecodeBytes(content)
+		if bytes.Equal(textenc.Encode(string(decoded), enc, bom), content) && !bytes.Equal(out, content) {
+			t.Fatalf("round trip mismatch:\n%q\n%q", out, content)
+		}
+	})
+}
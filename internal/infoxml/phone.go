@@ -2,16 +2,18 @@ package infoxml
 
 // BackupFilePhoneInfo 表示手机设备信息
 type BackupFilePhoneInfo struct {
-	ProductManufacturer string // 产品制造商
-	SnHash              string // 序列号哈希
-	VersionSdk          int    // SDK版本
-	DisplayId           string // 显示ID
-	BOPD_reason         string // BOPD原因
-	BOPD_running_mode   string // BOPD运行模式
-	BoardPlatform       string // 主板平台
-	ProductBrand        string // 产品品牌
-	ProductModel        string // 产品型号
-	VersionRelease      string // 系统版本
-	BOPD_info           string // BOPD信息
-	ProductDeviceId     string // 产品设备ID
+	ProductManufacturer string `infoxml:"productManufacturer,string"` // 产品制造商
+	SnHash              string `infoxml:"snHash,string"`              // 序列号哈希
+	VersionSdk          int    `infoxml:"versionSdk,integer"`         // SDK版本
+	DisplayId           string `infoxml:"displayId,string"`           // 显示ID
+	BOPD_reason         string `infoxml:"BOPD_reason,string"`         // BOPD原因
+	BOPD_running_mode   string `infoxml:"BOPD_running_mode,string"`   // BOPD运行模式
+	BoardPlatform       string `infoxml:"boardPlatform,string"`       // 主板平台
+	ProductBrand        string `infoxml:"productBrand,string"`        // 产品品牌
+	ProductModel        string `infoxml:"productModel,string"`        // 产品型号
+	VersionRelease      string `infoxml:"versionRelease,string"`      // 系统版本
+	BOPD_info           string `infoxml:"BOPD_info,string"`           // BOPD信息
+	ProductDeviceId     string `infoxml:"productDeviceId,string"`     // 产品设备ID
+
+	Extra map[string]Value // 未知的列
 }
@@ -0,0 +1,237 @@
+package infoxml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal"
+)
+
+// Schema 描述某个 BackupVersion 起 info.xml 中已知的表和列
+type Schema struct {
+	MinBackupVersion int           // 适用的最低 backupVersion
+	Tables           []TableSchema // 已知的表
+}
+
+// TableSchema 描述一个表
+type TableSchema struct {
+	Name     string       // 表名
+	Type     reflect.Type // 解码用的结构体，列定义来自 infoxml tag
+	Required bool         // 是否必须存在
+	Multiple bool         // 是否允许多行
+	Columns  []string     // 必须存在的列
+}
+
+// Schemas 已知的 schema，按 MinBackupVersion 升序排列
+//
+// 目前只在 backupVersion 29 上验证过，新版本的差异需要在这里追加
+var Schemas = []Schema{
+	{
+		MinBackupVersion: 29,
+		Tables: []TableSchema{
+			{Name: "HeaderInfo", Type: reflect.TypeFor[HeaderInfo](), Required: true, Columns: []string{"backupVersion", "dateTime"}},
+			{Name: "BackupFilePhoneInfo", Type: reflect.TypeFor[BackupFilePhoneInfo]()},
+			{Name: "BackupFileVersionInfo", Type: reflect.TypeFor[BackupFileVersionInfo](), Columns: []string{"backupVersionName"}},
+			{Name: "BackupFilesTypeInfo", Type: reflect.TypeFor[BackupFilesTypeInfo]()},
+			{Name: "BackupFileModuleInfo", Type: reflect.TypeFor[BackupFileModuleInfo](), Required: true, Multiple: true, Columns: []string{"name"}},
+		},
+	},
+}
+
+// SchemaFor 返回适用于 backupVersion 的 schema
+//
+// 没有完全对应的版本时使用不高于它的最新 schema，低于所有版本时使用最旧的 schema
+//
+//	r1 *Schema schema
+//	r2 bool 是否有 MinBackupVersion 正好等于 backupVersion 的 schema
+func SchemaFor(backupVersion int) (*Schema, bool) {
+	schema := &Schemas[0]
+	for i := range Schemas {
+		if Schemas[i].MinBackupVersion <= backupVersion {
+			schema = &Schemas[i]
+		}
+	}
+	return schema, schema.MinBackupVersion == backupVersion
+}
+
+// Severity 问题的严重程度
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue 表示校验发现的一个问题
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Table    string   `json:"table,omitempty"`
+	Row      int      `json:"row"` // 在同名表中的下标
+	Column   string   `json:"column,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	location := i.Table
+	if location != "" {
+		location += fmt.Sprintf("[%d]", i.Row)
+	}
+	if i.Column != "" {
+		location += "." + i.Column
+	}
+	if location == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, location, i.Message)
+}
+
+// HasErrors 判断是否有 error 级别的问题
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 按 HeaderInfo.backupVersion 对应的 schema 校验 info.xml
+//
+// 检查未知的表和列、缺少的必需表和列、类型错误、格式错误的 encMsgV3/checkMsgV3 以及重复的模块名
+func Validate(ix *InfoXml) []Issue {
+	var issues []Issue
+	add := func(severity Severity, table string, row int, column string, format string, args ...any) {
+		issues = append(issues, Issue{
+			Severity: severity,
+			Table:    table,
+			Row:      row,
+			Column:   column,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	backupVersion := 0
+	if header := ix.GetFirstRowByTable("HeaderInfo"); header != nil {
+		var err error
+		backupVersion, err = header.GetColumnInteger("backupVersion")
+		if err != nil {
+			add(SeverityError, "HeaderInfo", 0, "backupVersion", "%v", err)
+		}
+	}
+	schema, exact := SchemaFor(backupVersion)
+	if !exact {
+		add(SeverityWarning, "", 0, "", "no schema for backupVersion %d, using schema of backupVersion %d", backupVersion, schema.MinBackupVersion)
+	}
+
+	known := map[string]bool{}
+	for _, table := range schema.Tables {
+		known[table.Name] = true
+
+		rows := ix.GetRowsByTable(table.Name)
+		if len(rows) == 0 {
+			if table.Required {
+				add(SeverityError, table.Name, 0, "", "required table is missing")
+			}
+			continue
+		}
+		if len(rows) > 1 && !table.Multiple {
+			add(SeverityWarning, table.Name, 0, "", "table appears %d times, expected once", len(rows))
+		}
+
+		for i := range rows {
+			v := reflect.New(table.Type)
+			report, err := DecodeRow(&rows[i], v.Interface())
+			if err != nil {
+				add(SeverityError, table.Name, i, "", "%v", err)
+				continue
+			}
+			for _, column := range report.UnknownColumns {
+				add(SeverityWarning, table.Name, i, column, "unknown column")
+			}
+			for _, err := range report.Errors {
+				add(SeverityError, table.Name, i, "", "%v", err)
+			}
+			for _, column := range table.Columns {
+				if rows[i].ColumnState(column) != ValuePresent {
+					add(SeverityError, table.Name, i, column, "required column is missing or null")
+				}
+			}
+		}
+	}
+
+	// 未知的表
+	unknown := map[string]int{}
+	for _, row := range ix.Rows {
+		if !known[row.Table] {
+			unknown[row.Table]++
+		}
+	}
+	unknownTables := make([]string, 0, len(unknown))
+	for table := range unknown {
+		unknownTables = append(unknownTables, table)
+	}
+	sort.Strings(unknownTables)
+	for _, table := range unknownTables {
+		add(SeverityWarning, table, 0, "", "unknown table (%d rows)", unknown[table])
+	}
+
+	issues = append(issues, validateModules(ix)...)
+	return issues
+}
+
+// validateModules 检查模块名重复以及 encMsgV3、checkMsgV3 的格式
+func validateModules(ix *InfoXml) []Issue {
+	var issues []Issue
+	seen := map[string]int{}
+
+	for i, row := range ix.GetRowsByTable("BackupFileModuleInfo") {
+		add := func(column string, err error) {
+			issues = append(issues, Issue{
+				Severity: SeverityError,
+				Table:    "BackupFileModuleInfo",
+				Row:      i,
+				Column:   column,
+				Message:  err.Error(),
+			})
+		}
+
+		// 类型错误已经由 Validate 按 schema 报告，这里只检查内容
+		name, _ := row.GetColumnString("name")
+		if first, ok := seen[name]; ok && name != "" {
+			add("name", fmt.Errorf("duplicated module name %q, first at row %d", name, first))
+		} else {
+			seen[name] = i
+		}
+
+		if encMsgV3, _ := row.GetColumnString("encMsgV3"); encMsgV3 != "" {
+			_, err := internal.ParseEncMsgV3("", encMsgV3)
+			if err != nil {
+				add("encMsgV3", err)
+			}
+		}
+
+		if checkMsgV3, _ := row.GetColumnString("checkMsgV3"); checkMsgV3 != "" {
+			items, err := internal.ParseCheckMsgV3Mode(checkMsgV3, internal.CheckMsgV3Tolerant)
+			var itemsErr *internal.CheckMsgV3Error
+			switch {
+			case errors.As(err, &itemsErr):
+				for _, itemErr := range itemsErr.Items {
+					add("checkMsgV3", itemErr)
+				}
+			case err != nil:
+				add("checkMsgV3", err)
+				continue
+			}
+			files := map[string]bool{}
+			for _, item := range items {
+				if files[item.FileName] {
+					add("checkMsgV3", errors.New("duplicated file name "+item.FileName))
+				}
+				files[item.FileName] = true
+			}
+		}
+	}
+	return issues
+}
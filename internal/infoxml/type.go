@@ -2,10 +2,12 @@ package infoxml
 
 // BackupFilesTypeInfo 表示备份类型信息
 type BackupFilesTypeInfo struct {
-	EncryptType   int  // 加密类型
-	TypeAttch     int  // 类型附件
-	PromptMsg     bool // 提示消息(null)
-	EPerbackupkey bool // 加密备份密钥(null)
-	PwkeySalt     bool // 密码盐(null)
-	Type          int  // 类型
+	EncryptType   int  `infoxml:"encrypt_type,integer"` // 加密类型
+	TypeAttch     int  `infoxml:"type_attch,integer"`   // 类型附件
+	PromptMsg     bool `infoxml:"promptMsg,null"`       // 提示消息(null)
+	EPerbackupkey bool `infoxml:"e_perbackupkey,null"`  // 加密备份密钥(null)
+	PwkeySalt     bool `infoxml:"pwkey_salt,null"`      // 密码盐(null)
+	Type          int  `infoxml:"type,integer"`         // 类型
+
+	Extra map[string]Value // 未知的列
 }
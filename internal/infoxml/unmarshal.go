@@ -0,0 +1,263 @@
+package infoxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
+)
+
+// rawDocument 记录 info.xml 的原始格式
+type rawDocument struct {
+	prolog    string // 根元素之前的内容（XML 声明、空白、注释）
+	rootStart string // 根元素开始标签
+	endWs     string // 根元素结束标签之前的内容
+	rootEnd   string // 根元素结束标签
+	epilog    string // 根元素之后的内容
+
+	encoding textenc.Encoding // 原始文件的编码
+	bom      bool             // 原始文件是否有 BOM
+	style    style            // 新增元素使用的格式
+}
+
+// rawElement 记录 row 或 column 的原始格式
+type rawElement struct {
+	ws    string // 开始标签之前的内容
+	start string // 原始开始标签
+	attr  string // 解析时 table 或 name 属性的值
+	endWs string // 结束标签之前的内容
+	end   string // 原始结束标签，自闭合时为空
+}
+
+// rawValue 记录 value 的原始格式
+type rawValue struct {
+	ws     string    // 开始标签之前的内容
+	text   string    // 原始的整个 value 元素
+	order  []string  // 属性出现的顺序
+	fields [6]string // 解析时的值，用于判断是否被修改
+}
+
+// MaxSize info.xml 的最大大小，有上万个分片的备份也只有几 MB
+const MaxSize = 64 << 20
+
+// Unmarshal 解析 info.xml 内容，同时记录原始格式以便 Marshal 无损写回
+//
+// 支持 UTF-8、UTF-16 和 UTF-32 编码，Marshal 时按原始编码写回；content 不能超过 MaxSize
+func Unmarshal(content []byte) (*InfoXml, error) {
+	if len(content) > MaxSize {
+		return nil, fmt.Errorf("info.xml is larger than %d bytes: %w", MaxSize, textenc.ErrTooLarge)
+	}
+	content, enc, bom := textenc.DecodeBytes(content)
+	return unmarshalDecoded(content, enc, bom)
+}
+
+// unmarshalDecoded 解析已经解码为 UTF-8 的 info.xml，enc 和 bom 是原始编码，用于写回
+func unmarshalDecoded(content []byte, enc textenc.Encoding, bom bool) (*InfoXml, error) {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.CharsetReader = charsetReader
+
+	p := &rawParser{
+		content: content,
+		d:       d,
+	}
+	ix, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	ix.raw.encoding = enc
+	ix.raw.bom = bom
+	return ix, nil
+}
+
+// charsetReader 处理 XML 声明中的 encoding
+//
+// 内容在解析前已经解码为 UTF-8，这里只接受 Unicode 编码
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-16", "utf-16le", "utf-16be", "utf-32", "utf-32le", "utf-32be", "unicode":
+		return input, nil
+	}
+	return nil, fmt.Errorf("xml: unsupported encoding %q", charset)
+}
+
+type rawParser struct {
+	content []byte
+	d       *xml.Decoder
+	offset  int64  // 当前 token 的起始偏移
+	pending string // 尚未归属的原始内容（空白、注释等）
+}
+
+// next 返回下一个 token 及其原始文本
+func (p *rawParser) next() (xml.Token, string, error) {
+	p.offset = p.d.InputOffset()
+	tok, err := p.d.Token()
+	if err != nil {
+		return nil, "", err
+	}
+	return tok, string(p.content[p.offset:p.d.InputOffset()]), nil
+}
+
+// skip 跳过当前元素，返回整个元素的原始文本
+func (p *rawParser) skip() (string, error) {
+	start := p.offset
+	err := p.d.Skip()
+	if err != nil {
+		return "", err
+	}
+	return string(p.content[start:p.d.InputOffset()]), nil
+}
+
+// take 取出并清空 pending
+func (p *rawParser) take() string {
+	s := p.pending
+	p.pending = ""
+	return s
+}
+
+func (p *rawParser) parse() (*InfoXml, error) {
+	ix := &InfoXml{raw: &rawDocument{style: defaultStyle}}
+	doc := ix.raw
+
+	var row *Row
+	var column *Column
+	rootDone := false
+
+	for {
+		tok, raw, err := p.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case rootDone:
+				return nil, errors.New("xml: multiple root elements")
+
+			case ix.XMLName.Local == "":
+				// 根元素
+				if tok.Name.Local != "info.xml" {
+					return nil, fmt.Errorf("expected element type <info.xml> but have <%s>", tok.Name.Local)
+				}
+				ix.XMLName = tok.Name
+				doc.prolog = p.take()
+				doc.rootStart = raw
+
+			case row == nil && tok.Name.Local == "row":
+				row = &Row{
+					Table: attrValue(tok, "table"),
+					raw:   &rawElement{ws: p.take(), start: raw},
+				}
+				row.raw.attr = row.Table
+
+			case row != nil && column == nil && tok.Name.Local == "column":
+				column = &Column{
+					Name: attrValue(tok, "name"),
+					raw:  &rawElement{ws: p.take(), start: raw},
+				}
+				column.raw.attr = column.Name
+
+			case column != nil && column.Value == nil && tok.Name.Local == "value":
+				ws := p.take()
+				text, err := p.skip()
+				if err != nil {
+					return nil, err
+				}
+				column.Value = newRawValue(tok, ws, text)
+
+			default:
+				// 未知元素原样保留
+				text, err := p.skip()
+				if err != nil {
+					return nil, err
+				}
+				p.pending += text
+			}
+
+		case xml.EndElement:
+			switch {
+			case column != nil:
+				column.raw.endWs = p.take()
+				column.raw.end = raw
+				row.Columns = append(row.Columns, *column)
+				column = nil
+			case row != nil:
+				row.raw.endWs = p.take()
+				row.raw.end = raw
+				ix.Rows = append(ix.Rows, *row)
+				row = nil
+			default:
+				doc.endWs = p.take()
+				doc.rootEnd = raw
+				rootDone = true
+			}
+
+		default:
+			// 空白、注释、处理指令等
+			p.pending += raw
+		}
+	}
+
+	if !rootDone {
+		return nil, errors.New("xml: missing <info.xml> root element")
+	}
+	doc.epilog = p.take()
+	doc.style = inferStyle(ix)
+
+	return ix, nil
+}
+
+func attrValue(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// newRawValue 从 value 的开始标签构造 Value，并记录原始文本
+func newRawValue(start xml.StartElement, ws string, text string) *Value {
+	v := &Value{}
+	var order []string
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "String":
+			v.String = attr.Value
+		case "Integer":
+			v.Integer = attr.Value
+		case "Long":
+			v.Long = attr.Value
+		case "Boolean":
+			v.Boolean = attr.Value
+		case "Null":
+			v.Null = attr.Value
+		default:
+			continue
+		}
+		if v.Type == "" {
+			v.Type = attr.Name.Local
+		}
+		order = append(order, attr.Name.Local)
+	}
+
+	v.raw = &rawValue{
+		ws:     ws,
+		text:   text,
+		order:  order,
+		fields: v.fields(),
+	}
+	return v
+}
+
+// fields 返回所有属性值，用于判断 Value 是否被修改
+func (v *Value) fields() [6]string {
+	return [6]string{v.String, v.Integer, v.Long, v.Boolean, v.Null, v.Type}
+}
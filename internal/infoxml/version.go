@@ -2,7 +2,9 @@ package infoxml
 
 // BackupFileVersionInfo 表示备份版本信息
 type BackupFileVersionInfo struct {
-	DbVersion         int    // 数据库版本
-	SoftVersion       int    // 软件版本
-	BackupVersionName string // 备份版本名称
+	DbVersion         int    `infoxml:"dbVersion,integer"`        // 数据库版本
+	SoftVersion       int    `infoxml:"softVersion,integer"`      // 软件版本
+	BackupVersionName string `infoxml:"backupVersionName,string"` // 备份版本名称
+
+	Extra map[string]Value // 未知的列
 }
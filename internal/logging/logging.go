@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redacted 替换被隐藏的值
+const Redacted = "[REDACTED]"
+
+// Options 日志设置
+type Options struct {
+	Level        slog.Level
+	Format       string // text 或 json
+	DebugSecrets bool   // 输出 salt、IV、设备标识等敏感值
+}
+
+// forbiddenKeys 无论如何都不输出的属性，派生的密钥和密码可以直接解密备份
+var forbiddenKeys = map[string]bool{
+	"key":      true,
+	"aesKey":   true,
+	"password": true,
+}
+
+// New 创建写入 w 的日志
+//
+// Secret 包装的值默认输出为 [REDACTED]，DebugSecrets 时输出原值；
+// forbiddenKeys 中的属性总是被隐藏
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	handlerOpts := &slog.HandlerOptions{
+		Level: opts.Level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if forbiddenKeys[a.Key] {
+				return slog.String(a.Key, Redacted)
+			}
+			s, ok := a.Value.Any().(secretValue)
+			if !ok {
+				return a
+			}
+			if opts.DebugSecrets {
+				return slog.String(a.Key, s.String())
+			}
+			return slog.String(a.Key, Redacted)
+		},
+	}
+
+	var handler slog.Handler
+	switch opts.Format {
+	case "text", "":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", opts.Format)
+	}
+	return slog.New(handler), nil
+}
+
+// ParseLevel 解析 debug、info、warn、error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// Secret 包装可能帮助攻击者的值（salt、IV、snHash、设备 ID 等），默认在日志中隐藏
+//
+// []byte 以大写 hex 输出，其他类型以 %v 输出
+func Secret(v any) slog.LogValuer {
+	return secret{v: v}
+}
+
+type secret struct {
+	v any
+}
+
+// LogValue 返回 secretValue，由 New 创建的 handler 决定是否隐藏
+func (s secret) LogValue() slog.Value {
+	return slog.AnyValue(secretValue(s))
+}
+
+// secretValue 不实现 LogValuer，Resolve 之后仍能在 ReplaceAttr 中识别
+type secretValue struct {
+	v any
+}
+
+func (s secretValue) String() string {
+	if b, ok := s.v.([]byte); ok {
+		return strings.ToUpper(hex.EncodeToString(b))
+	}
+	return fmt.Sprint(s.v)
+}
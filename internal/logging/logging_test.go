@@ -0,0 +1,41 @@
+package logging_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/logging"
+)
+
+// TestRedaction 检查 Secret 默认被隐藏，密钥在任何设置下都不会输出
+func TestRedaction(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		for _, debugSecrets := range []bool{false, true} {
+			var buf bytes.Buffer
+			logger, err := logging.New(&buf, logging.Options{Format: format, DebugSecrets: debugSecrets})
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.Info("derived",
+				"salt", logging.Secret([]byte{0xab, 0xcd}),
+				slog.Group("device", "snHash", logging.Secret("sn-1234")),
+				"key", "85C973940B15BA7B",
+				"module", "com.tencent.mm",
+			)
+
+			out := buf.String()
+			if strings.Contains(out, "85C973940B15BA7B") {
+				t.Errorf("%s debugSecrets=%v: key material leaked: %s", format, debugSecrets, out)
+			}
+			hasSalt := strings.Contains(out, "ABCD") && strings.Contains(out, "sn-1234")
+			if hasSalt != debugSecrets {
+				t.Errorf("%s debugSecrets=%v: %s", format, debugSecrets, out)
+			}
+			if !strings.Contains(out, "com.tencent.mm") {
+				t.Errorf("%s: missing plain attribute: %s", format, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package textenc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding 表示文本编码
+type Encoding int
+
+const (
+	UTF8 Encoding = iota
+	UTF16LE
+	UTF16BE
+	UTF32LE
+	UTF32BE
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case UTF8:
+		return "UTF-8"
+	case UTF16LE:
+		return "UTF-16LE"
+	case UTF16BE:
+		return "UTF-16BE"
+	case UTF32LE:
+		return "UTF-32LE"
+	case UTF32BE:
+		return "UTF-32BE"
+	}
+	return "unknown"
+}
+
+// unitSize 返回编码单元的字节数
+func (e Encoding) unitSize() int {
+	switch e {
+	case UTF16LE, UTF16BE:
+		return 2
+	case UTF32LE, UTF32BE:
+		return 4
+	}
+	return 1
+}
+
+// BOM 返回编码对应的 BOM
+func (e Encoding) BOM() []byte {
+	switch e {
+	case UTF8:
+		return []byte{0xEF, 0xBB, 0xBF}
+	case UTF16LE:
+		return []byte{0xFF, 0xFE}
+	case UTF16BE:
+		return []byte{0xFE, 0xFF}
+	case UTF32LE:
+		return []byte{0xFF, 0xFE, 0x00, 0x00}
+	case UTF32BE:
+		return []byte{0x00, 0x00, 0xFE, 0xFF}
+	}
+	return nil
+}
+
+// sniffSize 统计判断编码时最多检查的字节数
+const sniffSize = 4096
+
+// MaxFileSize ReadFile 读取的最大文件大小
+const MaxFileSize = 64 << 20
+
+// ErrTooLarge 输入超过大小限制
+var ErrTooLarge = errors.New("input too large")
+
+// Detect 判断 head 的编码
+//
+// 先检查 BOM，没有 BOM 时统计空字节的位置：UTF-16/UTF-32 编码的 ASCII 文本包含大量空字节
+//
+//	head []byte 文件开头的内容
+//	r1 Encoding 编码
+//	r2 int BOM 长度，没有 BOM 时为 0
+func Detect(head []byte) (Encoding, int) {
+	// UTF-32LE 的 BOM 以 UTF-16LE 的 BOM 开头，需要先检查
+	for _, e := range []Encoding{UTF32LE, UTF32BE, UTF8, UTF16LE, UTF16BE} {
+		if bytes.HasPrefix(head, e.BOM()) {
+			return e, len(e.BOM())
+		}
+	}
+
+	if len(head) > sniffSize {
+		head = head[:sniffSize]
+	}
+
+	// zeros[i] 统计在 4 字节分组中第 i 个位置的空字节数
+	var zeros [4]int
+	for i, b := range head {
+		if b == 0 {
+			zeros[i%4]++
+		}
+	}
+	quads := len(head) / 4
+	units := len(head) / 2
+
+	switch {
+	case quads > 0 && zeros[1] > quads/2 && zeros[2] > quads/2 && zeros[3] > quads/2:
+		return UTF32LE, 0
+	case quads > 0 && zeros[0] > quads/2 && zeros[1] > quads/2 && zeros[2] > quads/2:
+		return UTF32BE, 0
+	case units > 0 && zeros[1]+zeros[3] > units/2:
+		return UTF16LE, 0
+	case units > 0 && zeros[0]+zeros[2] > units/2:
+		return UTF16BE, 0
+	}
+	return UTF8, 0
+}
+
+// NewReader 检测 r 的编码，返回去掉 BOM、解码为 UTF-8 的 io.Reader
+func NewReader(r io.Reader) (io.Reader, Encoding, bool, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, UTF8, false, err
+	}
+
+	enc, bomLen := Detect(head)
+	_, err = br.Discard(bomLen)
+	if err != nil {
+		return nil, UTF8, false, err
+	}
+
+	if enc == UTF8 {
+		return br, enc, bomLen > 0, nil
+	}
+	return &decoder{r: br, enc: enc}, enc, bomLen > 0, nil
+}
+
+// ReadFile 读取解码后不超过 MaxFileSize 的文件并解码为 UTF-8 字符串
+func ReadFile(path string) (string, Encoding, error) {
+	content, enc, _, err := ReadFileDecoded(path, MaxFileSize)
+	if err != nil {
+		return "", UTF8, err
+	}
+	return string(content), enc, nil
+}
+
+// ReadFileDecoded 用 NewReader 流式解码文件，只在内存中保留解码后的 UTF-8 内容
+//
+// 解码后超过 limit 字节时返回 ErrTooLarge，不会读入更多内容
+//
+//	r1 []byte UTF-8 内容（不含 BOM）
+//	r2 Encoding 原始编码
+//	r3 bool 原始内容是否有 BOM
+//	r4 error
+func ReadFileDecoded(path string, limit int64) ([]byte, Encoding, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, UTF8, false, err
+	}
+	defer file.Close()
+
+	r, enc, bom, err := NewReader(file)
+	if err != nil {
+		return nil, UTF8, false, err
+	}
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, UTF8, false, err
+	}
+	if int64(len(content)) > limit {
+		return nil, UTF8, false, fmt.Errorf("%s is larger than %d bytes after decoding: %w", path, limit, ErrTooLarge)
+	}
+	return content, enc, bom, nil
+}
+
+// ReadFileLimit 读取文件的原始内容，超过 limit 字节时返回 ErrTooLarge，不会读入更多内容
+func ReadFileLimit(path string, limit int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes: %w", path, limit, ErrTooLarge)
+	}
+	return content, nil
+}
+
+// DecodeBytes 检测编码并把 content 解码为 UTF-8
+//
+//	r1 []byte UTF-8 内容（不含 BOM）
+//	r2 Encoding 原始编码
+//	r3 bool 原始内容是否有 BOM
+func DecodeBytes(content []byte) ([]byte, Encoding, bool) {
+	enc, bomLen := Detect(content)
+	content = content[bomLen:]
+	if enc == UTF8 {
+		return content, enc, bomLen > 0
+	}
+
+	d := &decoder{r: bytes.NewReader(content), enc: enc}
+	out, _ := io.ReadAll(d)
+	return out, enc, bomLen > 0
+}
+
+// Encode 把 UTF-8 字符串编码为 enc，withBOM 为 true 时加上 BOM
+func Encode(s string, enc Encoding, withBOM bool) []byte {
+	var out []byte
+	if withBOM {
+		out = append(out, enc.BOM()...)
+	}
+
+	switch enc {
+	case UTF16LE, UTF16BE:
+		for _, u := range utf16.Encode([]rune(s)) {
+			if enc == UTF16LE {
+				out = binary.LittleEndian.AppendUint16(out, u)
+			} else {
+				out = binary.BigEndian.AppendUint16(out, u)
+			}
+		}
+	case UTF32LE, UTF32BE:
+		for _, r := range s {
+			if enc == UTF32LE {
+				out = binary.LittleEndian.AppendUint32(out, uint32(r))
+			} else {
+				out = binary.BigEndian.AppendUint32(out, uint32(r))
+			}
+		}
+	default:
+		out = append(out, s...)
+	}
+	return out
+}
+
+// decoder 把 UTF-16/UTF-32 流解码为 UTF-8
+//
+// 编码单元和代理对可能跨越两次 Read，不完整的部分留到下一次处理；
+// 文件末尾不完整的编码单元和孤立的代理项解码为 U+FFFD
+type decoder struct {
+	r   io.Reader
+	enc Encoding
+	in  []byte // 尚未解码的字节
+	out []byte // 已解码尚未返回的字节
+	err error  // 底层 Reader 返回的错误
+	buf [4096]byte
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		n, err := d.r.Read(d.buf[:])
+		d.in = append(d.in, d.buf[:n]...)
+		if err != nil {
+			d.err = err
+		}
+		d.decode(d.err != nil)
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// decode 解码 in 中完整的编码单元，final 为 true 时处理所有剩余字节
+func (d *decoder) decode(final bool) {
+	size := d.enc.unitSize()
+	in := d.in
+
+	for len(in) >= size {
+		var r rune
+		switch d.enc {
+		case UTF16LE, UTF16BE:
+			u := d.unit16(in)
+			if !utf16.IsSurrogate(rune(u)) {
+				r = rune(u)
+				in = in[2:]
+				break
+			}
+			// 高代理项需要和下一个编码单元一起解码
+			if len(in) < 4 {
+				if !final {
+					d.in = append(d.in[:0], in...)
+					return
+				}
+				r = utf8.RuneError
+				in = in[2:]
+				break
+			}
+			r = utf16.DecodeRune(rune(u), rune(d.unit16(in[2:])))
+			if r == utf8.RuneError {
+				in = in[2:]
+			} else {
+				in = in[4:]
+			}
+		case UTF32LE:
+			r = rune(binary.LittleEndian.Uint32(in))
+			in = in[4:]
+		case UTF32BE:
+			r = rune(binary.BigEndian.Uint32(in))
+			in = in[4:]
+		}
+
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		d.out = utf8.AppendRune(d.out, r)
+	}
+
+	if final && len(in) > 0 {
+		d.out = utf8.AppendRune(d.out, utf8.RuneError)
+		in = nil
+	}
+	d.in = append(d.in[:0], in...)
+}
+
+func (d *decoder) unit16(b []byte) uint16 {
+	if d.enc == UTF16LE {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return binary.BigEndian.Uint16(b)
+}
@@ -0,0 +1,120 @@
+package textenc_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/textenc"
+)
+
+const sample = "[headerinfo]\r\nhisuiteversion=14.0.0.320\r\napp_name=微信😀\r\n"
+
+// TestDetectAndDecode 检查各种编码在有无 BOM 时都能被识别并解码
+func TestDetectAndDecode(t *testing.T) {
+	encodings := []textenc.Encoding{textenc.UTF8, textenc.UTF16LE, textenc.UTF16BE, textenc.UTF32LE, textenc.UTF32BE}
+	for _, enc := range encodings {
+		for _, withBOM := range []bool{true, false} {
+			content := textenc.Encode(sample, enc, withBOM)
+
+			got, bomLen := textenc.Detect(content)
+			if got != enc || (bomLen > 0) != withBOM {
+				t.Errorf("Detect(%v, bom=%v) = %v, %d", enc, withBOM, got, bomLen)
+				continue
+			}
+
+			// 逐字节读取，检查跨越 Read 的编码单元和代理对
+			r, got, bom, err := textenc.NewReader(iotest.OneByteReader(bytes.NewReader(content)))
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if got != enc || bom != withBOM || string(out) != sample {
+				t.Errorf("NewReader(%v, bom=%v) = %v, %v, %q", enc, withBOM, got, bom, out)
+			}
+		}
+	}
+}
+
+// TestDecodeTruncated 检查奇数长度和孤立代理项解码为 U+FFFD
+func TestDecodeTruncated(t *testing.T) {
+	content := []byte{0xFF, 0xFE, 'a', 0, 0x3D, 0xD8, 'b'}
+	out, enc, _ := textenc.DecodeBytes(content)
+	if enc != textenc.UTF16LE || string(out) != "a��" {
+		t.Errorf("DecodeBytes = %v, %q", enc, out)
+	}
+}
+
+// FuzzDecode 检查任意内容都不会 panic，流式解码与 DecodeBytes 的结果一致且是合法的 UTF-8
+func FuzzDecode(f *testing.F) {
+	for _, enc := range []textenc.Encoding{textenc.UTF8, textenc.UTF16LE, textenc.UTF16BE, textenc.UTF32LE, textenc.UTF32BE} {
+		f.Add(textenc.Encode(sample, enc, true))
+		f.Add(textenc.Encode(sample, enc, false))
+	}
+	f.Add([]byte{0xFF, 0xFE, 'a'})
+	f.Add([]byte{0xFF, 0xFE, 0, 0, 'a'})
+	f.Add([]byte{0xFF, 0xFE, 0x3D, 0xD8, 0x3D, 0xD8})
+	f.Add([]byte{0x00, 0x00, 0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		out, enc, bom := textenc.DecodeBytes(content)
+		if !utf8.Valid(out) && enc != textenc.UTF8 {
+			t.Fatalf("DecodeBytes(%v) = %q is not valid UTF-8", enc, out)
+		}
+
+		r, streamEnc, streamBom, err := textenc.NewReader(iotest.OneByteReader(bytes.NewReader(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamed, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if streamEnc != enc || streamBom != bom || !bytes.Equal(streamed, out) {
+			t.Fatalf("NewReader = %v, %v, %q, DecodeBytes = %v, %v, %q", streamEnc, streamBom, streamed, enc, bom, out)
+		}
+	})
+}
+
+// TestReadFileDecoded 检查文件被流式解码，大小限制作用于解码后的内容
+func TestReadFileDecoded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(path, textenc.Encode(sample, textenc.UTF32BE, true), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, enc, bom, err := textenc.ReadFileDecoded(path, int64(len(sample)))
+	if err != nil || string(content) != sample || enc != textenc.UTF32BE || !bom {
+		t.Errorf("ReadFileDecoded = %q, %v, %v, %v", content, enc, bom, err)
+	}
+	_, _, _, err = textenc.ReadFileDecoded(path, int64(len(sample))-1)
+	if !errors.Is(err, textenc.ErrTooLarge) {
+		t.Errorf("ReadFileDecoded below the decoded size = %v, want ErrTooLarge", err)
+	}
+}
+
+// TestReadFileLimit 检查超过大小限制的文件返回 ErrTooLarge
+func TestReadFileLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(path, []byte("12345"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := textenc.ReadFileLimit(path, 5)
+	if err != nil || string(content) != "12345" {
+		t.Errorf("ReadFileLimit(5) = %q, %v", content, err)
+	}
+	_, err = textenc.ReadFileLimit(path, 4)
+	if !errors.Is(err, textenc.ErrTooLarge) {
+		t.Errorf("ReadFileLimit(4) = %v, want ErrTooLarge", err)
+	}
+}
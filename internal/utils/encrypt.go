@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// EncryptFile 加密文件，参数与 DecryptFile 相同，输出可以被 DecryptFile 解密
+func EncryptFile(in string, out string, key []byte, iv []byte, algo ALGO) error {
+	inFile, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	outFile, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		outFile.Close()
+		return err
+	}
+
+	switch algo {
+	case ALGO_AES_CTR:
+		err = CtrEncrypt(inFile, outFile, blockCipher, key, iv)
+	case ALGO_AES_GCM:
+		err = GcmEncrypt(inFile, outFile, blockCipher, key, iv)
+	default:
+		err = fmt.Errorf("unknown algo: %d", algo)
+	}
+	closeErr := outFile.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// CtrEncrypt CTR 加密和解密相同
+func CtrEncrypt(in io.Reader, out io.Writer, blockCipher cipher.Block, key []byte, iv []byte) error {
+	return CtrDecrypt(in, out, blockCipher, key, iv)
+}
+
+// GcmEncrypt 流式 GCM 加密，使用 16 字节 nonce，在密文末尾写入 16 字节 tag
+func GcmEncrypt(in io.Reader, out io.Writer, blockCipher cipher.Block, key []byte, iv []byte) error {
+	w, err := newEncryptWriter(out, blockCipher, iv, ALGO_AES_GCM)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// encryptWriter 把写入的明文加密后写入 out，GCM 在 Close 时追加 tag
+type encryptWriter struct {
+	keyStream   *keyStream
+	off         int64
+	out         io.Writer
+	buf         []byte
+	blockCipher cipher.Block
+	j0          [16]byte
+	ghash       *ghash // CTR 时为 nil
+	closed      bool
+}
+
+// NewEncryptWriter 返回流式加密的 io.WriteCloser，输出格式与 DecryptFile 相同
+//
+// GCM 使用 16 字节 nonce，Close 时在密文末尾写入 16 字节 tag；Close 不会关闭 out
+func NewEncryptWriter(out io.Writer, key []byte, iv []byte, algo ALGO) (io.WriteCloser, error) {
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptWriter(out, blockCipher, iv, algo)
+}
+
+func newEncryptWriter(out io.Writer, blockCipher cipher.Block, iv []byte, algo ALGO) (*encryptWriter, error) {
+	keyStream, err := newKeyStream(blockCipher, iv, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &encryptWriter{
+		keyStream:   keyStream,
+		out:         out,
+		blockCipher: blockCipher,
+	}
+	if algo == ALGO_AES_GCM {
+		w.j0 = gcmJ0(blockCipher, iv)
+		w.ghash = newGhash(blockCipher)
+	}
+	return w, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+	w.keyStream.xorKeyStream(buf, p, w.off)
+	w.off += int64(len(p))
+
+	if w.ghash != nil {
+		w.ghash.Write(buf)
+	}
+	_, err := w.out.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close 写入 GCM tag
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.ghash == nil {
+		return nil
+	}
+
+	s := w.ghash.sum()
+	var tag [16]byte
+	w.blockCipher.Encrypt(tag[:], w.j0[:])
+	subtle.XORBytes(tag[:], tag[:], s[:])
+	_, err := w.out.Write(tag[:])
+	return err
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// ghash 是 GCM 使用的 GHASH 的流式实现
+//
+// 标准库的 GCM 不支持流式处理，也不导出 J0 的计算，所以这里自己实现。
+// 实现参考 crypto/cipher 早期的 4-bit 查表实现。
+type ghash struct {
+	productTable [16]gcmFieldElement
+	y            gcmFieldElement
+	buf          [16]byte
+	bufLen       int
+	length       uint64
+}
+
+type gcmFieldElement struct {
+	low, high uint64
+}
+
+var gcmReductionTable = []uint16{
+	0x0000, 0x1c20, 0x3840, 0x2460, 0x7080, 0x6ca0, 0x48c0, 0x54e0,
+	0xe100, 0xfd20, 0xd940, 0xc560, 0x9180, 0x8da0, 0xa9c0, 0xb5e0,
+}
+
+// newGhash 使用 H = E(K, 0^128) 初始化 GHASH
+func newGhash(blockCipher cipher.Block) *ghash {
+	var key [16]byte
+	blockCipher.Encrypt(key[:], key[:])
+
+	g := &ghash{}
+	x := gcmFieldElement{
+		binary.BigEndian.Uint64(key[:8]),
+		binary.BigEndian.Uint64(key[8:]),
+	}
+	g.productTable[reverseBits(1)] = x
+	for i := 2; i < 16; i += 2 {
+		g.productTable[reverseBits(i)] = gcmDouble(&g.productTable[reverseBits(i/2)])
+		g.productTable[reverseBits(i+1)] = gcmAdd(&g.productTable[reverseBits(i)], &x)
+	}
+	return g
+}
+
+func reverseBits(i int) int {
+	i = ((i << 2) & 0xc) | ((i >> 2) & 0x3)
+	i = ((i << 1) & 0xa) | ((i >> 1) & 0x5)
+	return i
+}
+
+func gcmAdd(x, y *gcmFieldElement) gcmFieldElement {
+	return gcmFieldElement{x.low ^ y.low, x.high ^ y.high}
+}
+
+func gcmDouble(x *gcmFieldElement) (double gcmFieldElement) {
+	msbSet := x.high&1 == 1
+	double.high = x.high >> 1
+	double.high |= x.low << 63
+	double.low = x.low >> 1
+	if msbSet {
+		double.low ^= 0xe100000000000000
+	}
+	return
+}
+
+func (g *ghash) mul(y *gcmFieldElement) {
+	var z gcmFieldElement
+	for i := 0; i < 2; i++ {
+		word := y.high
+		if i == 1 {
+			word = y.low
+		}
+		for j := 0; j < 64; j += 4 {
+			msw := z.high & 0xf
+			z.high >>= 4
+			z.high |= z.low << 60
+			z.low >>= 4
+			z.low ^= uint64(gcmReductionTable[msw]) << 48
+
+			t := &g.productTable[word&0xf]
+			z.low ^= t.low
+			z.high ^= t.high
+			word >>= 4
+		}
+	}
+	*y = z
+}
+
+func (g *ghash) updateBlock(block []byte) {
+	g.y.low ^= binary.BigEndian.Uint64(block)
+	g.y.high ^= binary.BigEndian.Uint64(block[8:])
+	g.mul(&g.y)
+}
+
+// Write 追加数据，不足一个分组的部分会被缓存
+func (g *ghash) Write(p []byte) (int, error) {
+	n := len(p)
+	g.length += uint64(n)
+
+	if g.bufLen > 0 {
+		c := copy(g.buf[g.bufLen:], p)
+		g.bufLen += c
+		p = p[c:]
+		if g.bufLen < 16 {
+			return n, nil
+		}
+		g.updateBlock(g.buf[:])
+		g.bufLen = 0
+	}
+	for len(p) >= 16 {
+		g.updateBlock(p[:16])
+		p = p[16:]
+	}
+	g.bufLen = copy(g.buf[:], p)
+	return n, nil
+}
+
+// pad 用 0 补齐最后一个分组
+func (g *ghash) pad() {
+	if g.bufLen == 0 {
+		return
+	}
+	clear(g.buf[g.bufLen:])
+	g.updateBlock(g.buf[:])
+	g.bufLen = 0
+}
+
+// sum 追加长度分组并返回结果
+//
+// kobackup 不使用附加数据，所以 AAD 长度总是 0
+func (g *ghash) sum() [16]byte {
+	g.pad()
+	g.y.high ^= g.length * 8
+	g.mul(&g.y)
+
+	var out [16]byte
+	binary.BigEndian.PutUint64(out[:8], g.y.low)
+	binary.BigEndian.PutUint64(out[8:], g.y.high)
+	return out
+}
+
+// gcmJ0 计算 GCM 的初始计数器块 J0
+//
+// 12 字节以外的 nonce（kobackup 使用 16 字节）需要经过 GHASH
+func gcmJ0(blockCipher cipher.Block, iv []byte) [16]byte {
+	var j0 [16]byte
+	if len(iv) == 12 {
+		copy(j0[:], iv)
+		j0[15] = 1
+		return j0
+	}
+
+	g := newGhash(blockCipher)
+	g.Write(iv)
+	return g.sum()
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// keyStream 可以从任意偏移生成 CTR 密钥流
+//
+// GCM 的加密部分就是从 inc32(J0) 开始的 CTR，只是计数器只递增低 32 位
+type keyStream struct {
+	blockCipher cipher.Block
+	counter     [16]byte // 明文第 0 个分组对应的计数器
+	algo        ALGO
+}
+
+func newKeyStream(blockCipher cipher.Block, iv []byte, algo ALGO) (*keyStream, error) {
+	k := &keyStream{
+		blockCipher: blockCipher,
+		algo:        algo,
+	}
+
+	switch algo {
+	case ALGO_AES_CTR:
+		if len(iv) != aes.BlockSize {
+			return nil, fmt.Errorf("ctr iv must be %d bytes", aes.BlockSize)
+		}
+		copy(k.counter[:], iv)
+	case ALGO_AES_GCM:
+		if len(iv) == 0 {
+			return nil, errors.New("gcm iv is empty")
+		}
+		k.counter = gcmJ0(blockCipher, iv)
+		gcmInc32(&k.counter, 1)
+	default:
+		return nil, fmt.Errorf("unknown algo: %d", algo)
+	}
+
+	return k, nil
+}
+
+// xorKeyStream 用明文偏移 off 处的密钥流与 src 异或，写入 dst
+func (k *keyStream) xorKeyStream(dst, src []byte, off int64) {
+	blockIndex := uint64(off / aes.BlockSize)
+	skip := int(off % aes.BlockSize)
+
+	var counter, stream [16]byte
+	for len(src) > 0 {
+		counter = k.counterAt(blockIndex)
+		k.blockCipher.Encrypt(stream[:], counter[:])
+
+		n := subtle.XORBytes(dst, src, stream[skip:])
+		dst = dst[n:]
+		src = src[n:]
+		skip = 0
+		blockIndex++
+	}
+}
+
+// counterAt 计算第 blockIndex 个明文分组的计数器
+func (k *keyStream) counterAt(blockIndex uint64) [16]byte {
+	counter := k.counter
+	switch k.algo {
+	case ALGO_AES_GCM:
+		// GCM 只递增低 32 位
+		gcmInc32(&counter, uint32(blockIndex))
+	default:
+		// cipher.NewCTR 把整个分组当作 128 位大端整数递增
+		low := binary.BigEndian.Uint64(counter[8:])
+		high := binary.BigEndian.Uint64(counter[:8])
+		sum := low + blockIndex
+		if sum < low {
+			high++
+		}
+		binary.BigEndian.PutUint64(counter[8:], sum)
+		binary.BigEndian.PutUint64(counter[:8], high)
+	}
+	return counter
+}
+
+func gcmInc32(counter *[16]byte, n uint32) {
+	ctr := binary.BigEndian.Uint32(counter[12:])
+	binary.BigEndian.PutUint32(counter[12:], ctr+n)
+}
+
+// ctrWriter 把写入的密文解密后写入 out
+type ctrWriter struct {
+	keyStream *keyStream
+	off       int64
+	out       io.Writer
+	buf       []byte
+}
+
+func (w *ctrWriter) Write(p []byte) (int, error) {
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+	w.keyStream.xorKeyStream(buf, p, w.off)
+	w.off += int64(len(p))
+
+	_, err := w.out.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
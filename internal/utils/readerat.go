@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"os"
+)
+
+// GcmTagSize kobackup 的 GCM tag 长度，位于密文末尾
+const GcmTagSize = 16
+
+var ErrGcmTagMismatch = errors.New("gcm tag mismatch")
+
+// CipherReaderAt 提供对加密文件的随机访问解密
+//
+// GCM 的加密部分就是 CTR，所以可以从任意偏移开始解密。
+// 注意 ReadAt 不会校验 GCM tag，需要完整性时另外调用 VerifyGcmTag。
+type CipherReaderAt struct {
+	r         io.ReaderAt
+	size      int64
+	keyStream *keyStream
+}
+
+// NewCipherReaderAt 创建随机访问解密器
+//
+//	r io.ReaderAt 密文
+//	size int64 密文长度（GCM 包含末尾的 tag）
+func NewCipherReaderAt(r io.ReaderAt, size int64, key []byte, iv []byte, algo ALGO) (*CipherReaderAt, error) {
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if algo == ALGO_AES_GCM {
+		if size < GcmTagSize {
+			return nil, errors.New("ciphertext is shorter than gcm tag")
+		}
+		size -= GcmTagSize
+	}
+
+	keyStream, err := newKeyStream(blockCipher, iv, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CipherReaderAt{
+		r:         r,
+		size:      size,
+		keyStream: keyStream,
+	}, nil
+}
+
+// OpenCipherReaderAt 打开加密文件并创建随机访问解密器
+//
+// 调用者负责关闭返回的 *os.File
+func OpenCipherReaderAt(path string, key []byte, iv []byte, algo ALGO) (*CipherReaderAt, *os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	c, err := NewCipherReaderAt(file, fileInfo.Size(), key, iv, algo)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return c, file, nil
+}
+
+// Size 返回明文长度
+func (c *CipherReaderAt) Size() int64 {
+	return c.size
+}
+
+// ReadAt 实现 io.ReaderAt，从明文偏移 off 处解密
+func (c *CipherReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+
+	var eof error
+	if remain := c.size - off; int64(len(p)) > remain {
+		p = p[:remain]
+		eof = io.EOF
+	}
+
+	n, err := c.r.ReadAt(p, off)
+	c.keyStream.xorKeyStream(p[:n], p[:n], off)
+	if n < len(p) {
+		return n, err
+	}
+	return n, eof
+}
+
+// VerifyGcmTag 流式校验整个文件的 GCM tag，不输出明文
+//
+//	in io.Reader 密文（末尾 16 字节为 tag）
+//	err error tag 不匹配时返回 ErrGcmTagMismatch
+func VerifyGcmTag(in io.Reader, key []byte, iv []byte) error {
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	v := newGcmTagVerifier(blockCipher, iv, nil)
+	_, err = io.Copy(v, bufio.NewReader(in))
+	if err != nil {
+		return err
+	}
+	return v.Verify()
+}
+
+// gcmTagVerifier 在写入密文的同时计算 GHASH
+//
+// 总是保留最后 16 字节，直到 Verify 时把它们当作 tag。
+// 确定不是 tag 的密文同时会写入 body（可以为 nil）。
+type gcmTagVerifier struct {
+	blockCipher cipher.Block
+	j0          [16]byte
+	ghash       *ghash
+	body        io.Writer
+	tail        []byte
+}
+
+func newGcmTagVerifier(blockCipher cipher.Block, iv []byte, body io.Writer) *gcmTagVerifier {
+	g := newGhash(blockCipher)
+	if body == nil {
+		body = g
+	} else {
+		body = io.MultiWriter(g, body)
+	}
+
+	return &gcmTagVerifier{
+		blockCipher: blockCipher,
+		j0:          gcmJ0(blockCipher, iv),
+		ghash:       g,
+		body:        body,
+		tail:        make([]byte, 0, GcmTagSize),
+	}
+}
+
+func (v *gcmTagVerifier) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if len(v.tail)+len(p) <= GcmTagSize {
+		v.tail = append(v.tail, p...)
+		return n, nil
+	}
+
+	// tail 和 p 中除了最后 16 字节以外的部分都是密文
+	flush := len(v.tail) + len(p) - GcmTagSize
+	if flush <= len(v.tail) {
+		_, err := v.body.Write(v.tail[:flush])
+		if err != nil {
+			return 0, err
+		}
+		v.tail = append(v.tail[:0], v.tail[flush:]...)
+		v.tail = append(v.tail, p...)
+		return n, nil
+	}
+
+	_, err := v.body.Write(v.tail)
+	if err != nil {
+		return 0, err
+	}
+	flush -= len(v.tail)
+	_, err = v.body.Write(p[:flush])
+	if err != nil {
+		return 0, err
+	}
+	v.tail = append(v.tail[:0], p[flush:]...)
+	return n, nil
+}
+
+// Verify 比较计算出的 tag 和文件末尾的 tag
+func (v *gcmTagVerifier) Verify() error {
+	if len(v.tail) < GcmTagSize {
+		return errors.New("ciphertext is shorter than gcm tag")
+	}
+
+	s := v.ghash.sum()
+	var tag [16]byte
+	v.blockCipher.Encrypt(tag[:], v.j0[:])
+	subtle.XORBytes(tag[:], tag[:], s[:])
+
+	if subtle.ConstantTimeCompare(tag[:], v.tail) != 1 {
+		return ErrGcmTagMismatch
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package utils_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// TestCipherReaderAt 检查从任意偏移解密的结果与顺序解密一致
+func TestCipherReaderAt(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	plain := make([]byte, 4099)
+	rand.Read(key)
+	rand.Read(iv)
+	rand.Read(plain)
+
+	blockCipher, _ := aes.NewCipher(key)
+	aesGcm, _ := cipher.NewGCMWithNonceSize(blockCipher, 16)
+	gcmCipher := aesGcm.Seal(nil, iv, plain, nil)
+
+	ctrCipher := make([]byte, len(plain))
+	cipher.NewCTR(blockCipher, iv).XORKeyStream(ctrCipher, plain)
+
+	cases := map[string]struct {
+		algo       utils.ALGO
+		ciphertext []byte
+	}{
+		"gcm": {utils.ALGO_AES_GCM, gcmCipher},
+		"ctr": {utils.ALGO_AES_CTR, ctrCipher},
+	}
+	for name, c := range cases {
+		r, err := utils.NewCipherReaderAt(bytes.NewReader(c.ciphertext), int64(len(c.ciphertext)), key, iv, c.algo)
+		if err != nil {
+			t.Fatalf("%s: NewCipherReaderAt: %v", name, err)
+		}
+		if r.Size() != int64(len(plain)) {
+			t.Fatalf("%s: Size() = %d, want %d", name, r.Size(), len(plain))
+		}
+
+		for _, off := range []int64{0, 1, 15, 16, 17, 1000, 4080, 4098} {
+			buf := make([]byte, 37)
+			n, err := r.ReadAt(buf, off)
+			if err != nil && !errors.Is(err, io.EOF) {
+				t.Fatalf("%s: ReadAt(%d): %v", name, off, err)
+			}
+			if !bytes.Equal(buf[:n], plain[off:off+int64(n)]) {
+				t.Errorf("%s: ReadAt(%d) mismatch", name, off)
+			}
+		}
+
+		all, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+		if err != nil || !bytes.Equal(all, plain) {
+			t.Errorf("%s: full read mismatch: %v", name, err)
+		}
+	}
+
+	err := utils.VerifyGcmTag(bytes.NewReader(gcmCipher), key, iv)
+	if err != nil {
+		t.Errorf("VerifyGcmTag: %v", err)
+	}
+	gcmCipher[100] ^= 1
+	err = utils.VerifyGcmTag(bytes.NewReader(gcmCipher), key, iv)
+	if !errors.Is(err, utils.ErrGcmTagMismatch) {
+		t.Errorf("VerifyGcmTag on tampered data = %v, want ErrGcmTagMismatch", err)
+	}
+}
@@ -35,6 +35,7 @@ func DecryptFile(in string, out string, key []byte, iv []byte, algo ALGO) error
 
 	switch algo {
 	case ALGO_AES_CTR:
+		return CtrDecrypt(inFile, outFile, blockCipher, key, iv)
 	case ALGO_AES_GCM:
 		return GcmDecrypt(inFile, outFile, blockCipher, key, iv)
 	}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"crypto/aes"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// VerifyResult 一次读取密文得到的校验结果
+type VerifyResult struct {
+	Hmac   []byte // 密文的 HMAC，未传入 mac 时为 nil
+	TagErr error  // GCM tag 校验结果，CTR 总是 nil
+}
+
+// DecryptVerify 只读取一次密文，同时解密、计算 checkMsgV3 HMAC 并校验 GCM tag
+//
+// 明文会在 tag 校验完成前写入 out，调用者需要根据 TagErr 丢弃输出
+//
+//	mac hash.Hash 计算 checkMsgV3 HMAC，nil 时不计算
+//	out io.Writer 明文输出，io.Discard 时只做校验
+func DecryptVerify(in io.Reader, out io.Writer, key []byte, iv []byte, algo ALGO, mac hash.Hash) (VerifyResult, error) {
+	var result VerifyResult
+
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return result, err
+	}
+	keyStream, err := newKeyStream(blockCipher, iv, algo)
+	if err != nil {
+		return result, err
+	}
+
+	var body io.Writer
+	if out == io.Discard {
+		// 只校验时不需要生成密钥流
+		body = nil
+	} else {
+		body = &ctrWriter{keyStream: keyStream, out: out}
+	}
+
+	var sink io.Writer
+	var verifier *gcmTagVerifier
+	switch algo {
+	case ALGO_AES_GCM:
+		verifier = newGcmTagVerifier(blockCipher, iv, body)
+		sink = verifier
+	case ALGO_AES_CTR:
+		sink = body
+		if sink == nil {
+			sink = io.Discard
+		}
+	default:
+		return result, fmt.Errorf("unknown algo: %d", algo)
+	}
+
+	if mac != nil {
+		sink = io.MultiWriter(mac, sink)
+	}
+
+	_, err = io.Copy(sink, in)
+	if err != nil {
+		return result, err
+	}
+
+	if mac != nil {
+		result.Hmac = mac.Sum(nil)
+	}
+	if verifier != nil {
+		result.TagErr = verifier.Verify()
+	}
+	return result, nil
+}
+
+// DecryptVerifyReader 是 DecryptVerify 的流式版本，明文交给 fn 读取，不会整个放在内存中
+//
+// fn 读到的明文在返回的 TagErr 为 nil 之前都没有经过认证，调用者需要据此丢弃 fn 的结果。
+// fn 没有读完的明文会被丢弃；fn 返回错误时停止解密并返回这个错误
+func DecryptVerifyReader(in io.Reader, key []byte, iv []byte, algo ALGO, mac hash.Hash, fn func(plain io.Reader) error) (VerifyResult, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := fn(pr)
+		if err != nil {
+			// 让 DecryptVerify 的写入失败，不再解密
+			pr.CloseWithError(err)
+		} else {
+			io.Copy(io.Discard, pr)
+		}
+		done <- err
+	}()
+
+	result, err := DecryptVerify(in, pw, key, iv, algo, mac)
+	pw.CloseWithError(err)
+	fnErr := <-done
+	if fnErr != nil {
+		return result, fnErr
+	}
+	return result, err
+}
+
+// DecryptVerifyFile 是 DecryptVerify 的文件版本
+//
+// tag 校验失败或出错时删除输出文件，out 为空时只做校验
+func DecryptVerifyFile(in string, out string, key []byte, iv []byte, algo ALGO, mac hash.Hash) (VerifyResult, error) {
+	inFile, err := os.Open(in)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	defer inFile.Close()
+
+	if out == "" {
+		return DecryptVerify(inFile, io.Discard, key, iv, algo, mac)
+	}
+
+	outFile, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	result, err := DecryptVerify(inFile, outFile, key, iv, algo, mac)
+	closeErr := outFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil || result.TagErr != nil {
+		os.Remove(out)
+	}
+	return result, err
+}
@@ -0,0 +1,101 @@
+package utils_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Lensual/KobackupCipherTool-go/internal/utils"
+)
+
+// TestDecryptVerify 检查单次读取的解密、HMAC 和 GCM tag 结果
+func TestDecryptVerify(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	plain := make([]byte, 100000)
+	rand.Read(key)
+	rand.Read(iv)
+	rand.Read(plain)
+
+	blockCipher, _ := aes.NewCipher(key)
+	aesGcm, _ := cipher.NewGCMWithNonceSize(blockCipher, 16)
+	ciphertext := aesGcm.Seal(nil, iv, plain, nil)
+
+	expected := hmac.New(sha256.New, []byte("key"))
+	expected.Write(ciphertext)
+
+	var out bytes.Buffer
+	result, err := utils.DecryptVerify(bytes.NewReader(ciphertext), &out, key, iv, utils.ALGO_AES_GCM, hmac.New(sha256.New, []byte("key")))
+	if err != nil {
+		t.Fatalf("DecryptVerify: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Errorf("plaintext mismatch")
+	}
+	if !hmac.Equal(result.Hmac, expected.Sum(nil)) {
+		t.Errorf("hmac mismatch")
+	}
+	if result.TagErr != nil {
+		t.Errorf("TagErr = %v", result.TagErr)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	result, err = utils.DecryptVerify(bytes.NewReader(ciphertext), io.Discard, key, iv, utils.ALGO_AES_GCM, nil)
+	if err != nil {
+		t.Fatalf("DecryptVerify: %v", err)
+	}
+	if !errors.Is(result.TagErr, utils.ErrGcmTagMismatch) {
+		t.Errorf("TagErr on tampered tag = %v, want ErrGcmTagMismatch", result.TagErr)
+	}
+}
+
+// TestDecryptVerifyReader 检查流式解密得到的明文和校验结果，以及 fn 出错时停止解密
+func TestDecryptVerifyReader(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	plain := make([]byte, 100000)
+	rand.Read(key)
+	rand.Read(iv)
+	rand.Read(plain)
+
+	blockCipher, _ := aes.NewCipher(key)
+	aesGcm, _ := cipher.NewGCMWithNonceSize(blockCipher, 16)
+	ciphertext := aesGcm.Seal(nil, iv, plain, nil)
+
+	var got []byte
+	result, err := utils.DecryptVerifyReader(bytes.NewReader(ciphertext), key, iv, utils.ALGO_AES_GCM, nil, func(r io.Reader) error {
+		var err error
+		got, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil || result.TagErr != nil {
+		t.Fatalf("DecryptVerifyReader = %v, %v", err, result.TagErr)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("plaintext mismatch")
+	}
+
+	// 只读取一部分时仍然校验整个文件
+	ciphertext[len(ciphertext)-1] ^= 1
+	result, err = utils.DecryptVerifyReader(bytes.NewReader(ciphertext), key, iv, utils.ALGO_AES_GCM, nil, func(r io.Reader) error {
+		_, err := io.ReadFull(r, make([]byte, 10))
+		return err
+	})
+	if err != nil || !errors.Is(result.TagErr, utils.ErrGcmTagMismatch) {
+		t.Errorf("DecryptVerifyReader on tampered tag = %v, %v", err, result.TagErr)
+	}
+
+	stop := errors.New("stop")
+	_, err = utils.DecryptVerifyReader(bytes.NewReader(ciphertext), key, iv, utils.ALGO_AES_GCM, nil, func(r io.Reader) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("DecryptVerifyReader with failing fn = %v, want %v", err, stop)
+	}
+}